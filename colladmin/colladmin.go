@@ -0,0 +1,312 @@
+package colladmin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xkeyideal/mongo-tools/common/db"
+	"github.com/xkeyideal/mongo-tools/common/util"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CreateOptions are the options of a new collection.
+type CreateOptions struct {
+	// Capped collections require a Size in bytes, Max optionally limits
+	// their number of documents
+	Capped bool  `json:"capped,omitempty"`
+	Size   int64 `json:"size,omitempty"`
+	Max    int64 `json:"max,omitempty"`
+
+	Validator        bson.M `json:"validator,omitempty"`
+	ValidationLevel  string `json:"validationLevel,omitempty"`
+	ValidationAction string `json:"validationAction,omitempty"`
+
+	// Collation is the default collation, e.g. {"locale": "en"}
+	Collation bson.M `json:"collation,omitempty"`
+}
+
+// CollModOptions are the changes of a collMod. Only the set fields are
+// changed.
+type CollModOptions struct {
+	// IndexName and ExpireAfterSeconds change the TTL of an index
+	IndexName          string `json:"indexName,omitempty"`
+	ExpireAfterSeconds *int64 `json:"expireAfterSeconds,omitempty"`
+
+	// Validator replaces the validation rules, an empty one removes them
+	Validator        *bson.M `json:"validator,omitempty"`
+	ValidationLevel  string  `json:"validationLevel,omitempty"`
+	ValidationAction string  `json:"validationAction,omitempty"`
+}
+
+// DropConfirmation guards a drop: the namespace must be repeated exactly,
+// and the count must be the current number of documents of the collection.
+type DropConfirmation struct {
+	Namespace string `json:"namespace"`
+	Count     int64  `json:"count"`
+}
+
+type CollAdmin struct {
+	// for connecting to the db
+	SessionProvider *db.SessionProvider
+}
+
+func NewCollAdmin(sp *db.SessionProvider) *CollAdmin {
+	return &CollAdmin{
+		SessionProvider: sp,
+	}
+}
+
+// splitNamespace validates a full namespace and returns its database and
+// collection
+func splitNamespace(ns string) (string, string, error) {
+	if err := util.ValidateFullNamespace(ns); err != nil {
+		return "", "", err
+	}
+	dot := strings.Index(ns, ".")
+	if dot < 0 {
+		return "", "", fmt.Errorf("namespace %v has no collection", ns)
+	}
+	return ns[:dot], ns[dot+1:], nil
+}
+
+// protectedReason returns why the collection of dbName must not be dropped or
+// renamed, or "" if it may be: the system collections, the config database of
+// a sharded cluster and the oplog are needed by the server itself.
+func protectedReason(dbName, collection string) string {
+	switch {
+	case strings.HasPrefix(collection, "system."):
+		return "it is a system collection"
+	case dbName == "config":
+		return "it holds the metadata of the sharded cluster"
+	case dbName == "local" && strings.HasPrefix(collection, "oplog."):
+		return "it is the oplog"
+	}
+	return ""
+}
+
+func validateValidation(level, action string) error {
+	switch level {
+	case "", "off", "strict", "moderate":
+	default:
+		return fmt.Errorf("invalid validationLevel %v, must be off, strict or moderate", level)
+	}
+	switch action {
+	case "", "error", "warn":
+	default:
+		return fmt.Errorf("invalid validationAction %v, must be error or warn", action)
+	}
+	return nil
+}
+
+func (ca *CollAdmin) run(dbName string, cmd bson.D) error {
+	session, err := ca.SessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	result := bson.M{}
+	return session.DB(dbName).Run(cmd, &result)
+}
+
+// Create creates the collection ns with the options
+// https://docs.mongodb.com/v3.4/reference/command/create/
+func (ca *CollAdmin) Create(ns string, opts *CreateOptions) error {
+	dbName, collection, err := splitNamespace(ns)
+	if err != nil {
+		return err
+	}
+	if opts == nil {
+		opts = &CreateOptions{}
+	}
+	if opts.Capped && opts.Size <= 0 {
+		return errors.New("a capped collection requires a size")
+	}
+	if !opts.Capped && (opts.Size > 0 || opts.Max > 0) {
+		return errors.New("size and max only apply to capped collections")
+	}
+	if err := validateValidation(opts.ValidationLevel, opts.ValidationAction); err != nil {
+		return err
+	}
+
+	cmd := bson.D{{"create", collection}}
+	if opts.Capped {
+		cmd = append(cmd, bson.DocElem{"capped", true}, bson.DocElem{"size", opts.Size})
+		if opts.Max > 0 {
+			cmd = append(cmd, bson.DocElem{"max", opts.Max})
+		}
+	}
+	if len(opts.Validator) > 0 {
+		cmd = append(cmd, bson.DocElem{"validator", opts.Validator})
+	}
+	if opts.ValidationLevel != "" {
+		cmd = append(cmd, bson.DocElem{"validationLevel", opts.ValidationLevel})
+	}
+	if opts.ValidationAction != "" {
+		cmd = append(cmd, bson.DocElem{"validationAction", opts.ValidationAction})
+	}
+	if len(opts.Collation) > 0 {
+		cmd = append(cmd, bson.DocElem{"collation", opts.Collation})
+	}
+
+	if err := ca.run(dbName, cmd); err != nil {
+		return fmt.Errorf("error creating %v: %v", ns, err)
+	}
+	return nil
+}
+
+// ConvertToCapped converts the collection ns to a capped collection of size
+// bytes. The collection is locked while its documents are copied.
+// https://docs.mongodb.com/v3.2/reference/command/convertToCapped/
+func (ca *CollAdmin) ConvertToCapped(ns string, size int64) error {
+	dbName, collection, err := splitNamespace(ns)
+	if err != nil {
+		return err
+	}
+	if size <= 0 {
+		return errors.New("a capped collection requires a size")
+	}
+
+	cmd := bson.D{{"convertToCapped", collection}, {"size", size}}
+	if err := ca.run(dbName, cmd); err != nil {
+		return fmt.Errorf("error converting %v to capped: %v", ns, err)
+	}
+	return nil
+}
+
+// Rename renames the collection from to the namespace to, which may be in
+// another database, in which case the documents are copied. With dropTarget
+// an existing collection to is dropped first, otherwise the rename fails.
+// Neither may be a protected collection, such as the oplog.
+// https://docs.mongodb.com/v3.2/reference/command/renameCollection/
+func (ca *CollAdmin) Rename(from, to string, dropTarget bool) error {
+	fromDB, fromCollection, err := splitNamespace(from)
+	if err != nil {
+		return err
+	}
+	toDB, toCollection, err := splitNamespace(to)
+	if err != nil {
+		return err
+	}
+	if reason := protectedReason(fromDB, fromCollection); reason != "" {
+		return fmt.Errorf("refusing to rename %v: %v", from, reason)
+	}
+	if reason := protectedReason(toDB, toCollection); reason != "" {
+		return fmt.Errorf("refusing to rename %v to %v: %v", from, to, reason)
+	}
+	if from == to {
+		return fmt.Errorf("cannot rename %v to itself", from)
+	}
+
+	cmd := bson.D{{"renameCollection", from}, {"to", to}}
+	if dropTarget {
+		cmd = append(cmd, bson.DocElem{"dropTarget", true})
+	}
+	if err := ca.run("admin", cmd); err != nil {
+		return fmt.Errorf("error renaming %v to %v: %v", from, to, err)
+	}
+	return nil
+}
+
+// CollMod changes the TTL of an index, or the validation rules, of the
+// collection ns
+// https://docs.mongodb.com/v3.2/reference/command/collMod/
+func (ca *CollAdmin) CollMod(ns string, mod *CollModOptions) error {
+	dbName, collection, err := splitNamespace(ns)
+	if err != nil {
+		return err
+	}
+	if mod == nil {
+		return errors.New("nothing to modify")
+	}
+	if (mod.IndexName == "") != (mod.ExpireAfterSeconds == nil) {
+		return errors.New("changing a TTL requires both an index name and expireAfterSeconds")
+	}
+	if mod.ExpireAfterSeconds != nil && *mod.ExpireAfterSeconds < 0 {
+		return errors.New("expireAfterSeconds must not be negative")
+	}
+	if err := validateValidation(mod.ValidationLevel, mod.ValidationAction); err != nil {
+		return err
+	}
+
+	cmd := bson.D{{"collMod", collection}}
+	if mod.IndexName != "" {
+		cmd = append(cmd, bson.DocElem{"index", bson.D{
+			{"name", mod.IndexName},
+			{"expireAfterSeconds", *mod.ExpireAfterSeconds},
+		}})
+	}
+	if mod.Validator != nil {
+		cmd = append(cmd, bson.DocElem{"validator", *mod.Validator})
+	}
+	if mod.ValidationLevel != "" {
+		cmd = append(cmd, bson.DocElem{"validationLevel", mod.ValidationLevel})
+	}
+	if mod.ValidationAction != "" {
+		cmd = append(cmd, bson.DocElem{"validationAction", mod.ValidationAction})
+	}
+	if len(cmd) == 1 {
+		return errors.New("nothing to modify")
+	}
+
+	if err := ca.run(dbName, cmd); err != nil {
+		return fmt.Errorf("error modifying %v: %v", ns, err)
+	}
+	return nil
+}
+
+// Count returns the number of documents of the collection ns, as a drop
+// must confirm it.
+func (ca *CollAdmin) Count(ns string) (int64, error) {
+	dbName, collection, err := splitNamespace(ns)
+	if err != nil {
+		return 0, err
+	}
+
+	session, err := ca.SessionProvider.GetSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	count, err := session.DB(dbName).C(collection).Count()
+	if err != nil {
+		return 0, fmt.Errorf("error counting %v: %v", ns, err)
+	}
+	return int64(count), nil
+}
+
+// Drop drops the collection ns, only if the confirmation repeats the exact
+// namespace and the current number of its documents, so that a typo or a
+// collection which grew since it was checked is not dropped. System
+// collections, the config database and the oplog are never dropped.
+// https://docs.mongodb.com/v3.2/reference/command/drop/
+func (ca *CollAdmin) Drop(ns string, confirm DropConfirmation) error {
+	dbName, collection, err := splitNamespace(ns)
+	if err != nil {
+		return err
+	}
+	if reason := protectedReason(dbName, collection); reason != "" {
+		return fmt.Errorf("refusing to drop %v: %v", ns, reason)
+	}
+	if confirm.Namespace != ns {
+		return fmt.Errorf("confirmation namespace %q does not match %q", confirm.Namespace, ns)
+	}
+
+	count, err := ca.Count(ns)
+	if err != nil {
+		return err
+	}
+	if count != confirm.Count {
+		return fmt.Errorf("%v has %v documents, not the %v confirmed", ns, count, confirm.Count)
+	}
+
+	if err := ca.run(dbName, bson.D{{"drop", collection}}); err != nil {
+		return fmt.Errorf("error dropping %v: %v", ns, err)
+	}
+	return nil
+}
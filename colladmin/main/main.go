@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/xkeyideal/mongo-tools/colladmin"
+	"github.com/xkeyideal/mongo-tools/common/db"
+	"github.com/xkeyideal/mongo-tools/common/options"
+)
+
+func main() {
+	opts := options.New("mongocolladmin")
+	opts.Addrs = []string{"127.0.0.1:27017"}
+	opts.Source = "admin"
+	opts.Username = "root"
+	opts.Password = "123456789"
+	opts.Timeout = 2
+	opts.TCPKeepAliveSeconds = 2
+
+	sessionProvider, err := db.NewSessionProvider(opts)
+	if err != nil {
+		os.Exit(-1)
+	}
+	defer sessionProvider.Close()
+
+	admin := colladmin.NewCollAdmin(sessionProvider)
+	if len(os.Args) < 2 {
+		err = admin.Create("MongoReplTest.events", &colladmin.CreateOptions{
+			Capped: true,
+			Size:   64 * 1024 * 1024,
+		})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	// the count is confirmed by passing it as an argument, and nothing is
+	// dropped if the collection no longer has that many documents
+	count, err := admin.Count("MongoReplTest.events")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("MongoReplTest.events has %v documents\n", count)
+	if len(os.Args) < 2 {
+		fmt.Println("to drop it, run again with its document count as the argument")
+		return
+	}
+	confirmed, err := strconv.ParseInt(os.Args[1], 10, 64)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err = admin.Drop("MongoReplTest.events", colladmin.DropConfirmation{
+		Namespace: "MongoReplTest.events",
+		Count:     confirmed,
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
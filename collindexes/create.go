@@ -0,0 +1,393 @@
+package collindexes
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// IndexSpec describes an index with the options mgo.Index lacks, such as
+// partialFilterExpression. Key follows the mgo.Index convention: "a" is
+// ascending, "-a" descending, and "$kind:a" an index of that kind, e.g.
+// "$text:a", "$2dsphere:a" or "$hashed:a".
+type IndexSpec struct {
+	Name string   `json:"name,omitempty"`
+	Key  []string `json:"key"`
+
+	Unique     bool `json:"unique,omitempty"`
+	Sparse     bool `json:"sparse,omitempty"`
+	Background bool `json:"background,omitempty"`
+
+	PartialFilterExpression bson.M `json:"partialFilterExpression,omitempty"`
+
+	// ExpireAfterSeconds makes a TTL index, 0 expires documents at the time
+	// of their indexed date
+	ExpireAfterSeconds *int64 `json:"expireAfterSeconds,omitempty"`
+
+	// Collation is e.g. {"locale": "en", "strength": 2}
+	Collation bson.M `json:"collation,omitempty"`
+
+	// Options of text indexes: the weight of each text field, 1 if not
+	// given, the language of the documents without one, and the field
+	// holding the language of a document
+	Weights          bson.M `json:"weights,omitempty"`
+	DefaultLanguage  string `json:"default_language,omitempty"`
+	LanguageOverride string `json:"language_override,omitempty"`
+
+	// SphereIndexVersion is the version of a 2dsphere index
+	SphereIndexVersion int `json:"2dsphereIndexVersion,omitempty"`
+
+	// Options of 2d indexes: the precision of the geohash, and the bounds of
+	// the coordinates
+	Bits int      `json:"bits,omitempty"`
+	Min  *float64 `json:"min,omitempty"`
+	Max  *float64 `json:"max,omitempty"`
+}
+
+// The server defaults of the text and geo index options
+const (
+	defaultLanguage         = "english"
+	defaultLanguageOverride = "language"
+	default2dBits           = 26
+	default2dMin            = -180.0
+	default2dMax            = 180.0
+)
+
+// liveIndex is an index as reported by listIndexes
+type liveIndex struct {
+	Name                    string `bson:"name"`
+	Key                     bson.D `bson:"key"`
+	Unique                  bool   `bson:"unique"`
+	Sparse                  bool   `bson:"sparse"`
+	Background              bool   `bson:"background"`
+	PartialFilterExpression bson.M `bson:"partialFilterExpression"`
+	ExpireAfterSeconds      *int64 `bson:"expireAfterSeconds"`
+	Collation               bson.M `bson:"collation"`
+	Weights                 bson.M `bson:"weights"`
+
+	DefaultLanguage    string   `bson:"default_language"`
+	LanguageOverride   string   `bson:"language_override"`
+	SphereIndexVersion int      `bson:"2dsphereIndexVersion"`
+	Bits               int      `bson:"bits"`
+	Min                *float64 `bson:"min"`
+	Max                *float64 `bson:"max"`
+}
+
+type listIndexesResult struct {
+	Cursor struct {
+		FirstBatch []liveIndex `bson:"firstBatch"`
+	} `bson:"cursor"`
+}
+
+// keyDoc returns the key document of the index
+func (spec *IndexSpec) keyDoc() (bson.D, error) {
+	if len(spec.Key) == 0 {
+		return nil, errors.New("index key is empty")
+	}
+	doc := bson.D{}
+	for _, field := range spec.Key {
+		var value interface{} = 1
+		switch {
+		case strings.HasPrefix(field, "$"):
+			colon := strings.Index(field, ":")
+			if colon < 2 || colon == len(field)-1 {
+				return nil, fmt.Errorf("invalid index key field %q, expected $kind:field", field)
+			}
+			value = field[1:colon]
+			field = field[colon+1:]
+		case strings.HasPrefix(field, "-"):
+			value = -1
+			field = field[1:]
+		case strings.HasPrefix(field, "+"):
+			field = field[1:]
+		}
+		if field == "" {
+			return nil, fmt.Errorf("invalid index key %v", spec.Key)
+		}
+		doc = append(doc, bson.DocElem{field, value})
+	}
+	return doc, nil
+}
+
+// hasKind reports whether a field of the key is an index of kind, e.g. text
+func (spec *IndexSpec) hasKind(kind string) bool {
+	for _, field := range spec.Key {
+		if strings.HasPrefix(field, "$"+kind+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// textWeights returns the weight of every text field of the key, 1 unless
+// Weights gives another.
+func (spec *IndexSpec) textWeights() map[string]interface{} {
+	weights := map[string]interface{}{}
+	for _, field := range spec.Key {
+		if strings.HasPrefix(field, "$text:") {
+			weights[field[len("$text:"):]] = 1
+		}
+	}
+	for field, weight := range spec.Weights {
+		weights[field] = weight
+	}
+	return weights
+}
+
+// The text and 2d options of the index, or their server defaults
+func (spec *IndexSpec) defaultLanguage() string {
+	if spec.DefaultLanguage == "" {
+		return defaultLanguage
+	}
+	return spec.DefaultLanguage
+}
+
+func (spec *IndexSpec) languageOverride() string {
+	if spec.LanguageOverride == "" {
+		return defaultLanguageOverride
+	}
+	return spec.LanguageOverride
+}
+
+func (spec *IndexSpec) bits() int {
+	if spec.Bits == 0 {
+		return default2dBits
+	}
+	return spec.Bits
+}
+
+func (spec *IndexSpec) min() float64 {
+	if spec.Min == nil {
+		return default2dMin
+	}
+	return *spec.Min
+}
+
+func (spec *IndexSpec) max() float64 {
+	if spec.Max == nil {
+		return default2dMax
+	}
+	return *spec.Max
+}
+
+// IndexName returns the name of the index, or the name the server would
+// give it, e.g. a_1_b_-1.
+func (spec *IndexSpec) IndexName() string {
+	if spec.Name != "" {
+		return spec.Name
+	}
+	doc, err := spec.keyDoc()
+	if err != nil {
+		return ""
+	}
+	parts := []string{}
+	for _, elem := range doc {
+		parts = append(parts, fmt.Sprintf("%v_%v", elem.Name, elem.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// Validate checks the index options
+func (spec *IndexSpec) Validate() error {
+	doc, err := spec.keyDoc()
+	if err != nil {
+		return err
+	}
+	if spec.ExpireAfterSeconds != nil {
+		if *spec.ExpireAfterSeconds < 0 {
+			return fmt.Errorf("index %v: expireAfterSeconds must not be negative", spec.IndexName())
+		}
+		if len(doc) != 1 {
+			return fmt.Errorf("index %v: TTL indexes must have a single field", spec.IndexName())
+		}
+	}
+	if spec.Sparse && len(spec.PartialFilterExpression) > 0 {
+		return fmt.Errorf("index %v: sparse and partialFilterExpression cannot be combined", spec.IndexName())
+	}
+	if len(spec.Collation) > 0 {
+		if _, ok := spec.Collation["locale"]; !ok {
+			return fmt.Errorf("index %v: collation requires a locale", spec.IndexName())
+		}
+	}
+	if len(spec.Weights) > 0 || spec.DefaultLanguage != "" || spec.LanguageOverride != "" {
+		if !spec.hasKind("text") {
+			return fmt.Errorf("index %v: weights and languages only apply to text indexes", spec.IndexName())
+		}
+		for field := range spec.Weights {
+			if !spec.hasField("$text:" + field) {
+				return fmt.Errorf("index %v: weighted field %v is not a text field of the key", spec.IndexName(), field)
+			}
+		}
+	}
+	if spec.SphereIndexVersion != 0 && !spec.hasKind("2dsphere") {
+		return fmt.Errorf("index %v: 2dsphereIndexVersion only applies to 2dsphere indexes", spec.IndexName())
+	}
+	if spec.Bits != 0 || spec.Min != nil || spec.Max != nil {
+		if !spec.hasKind("2d") {
+			return fmt.Errorf("index %v: bits, min and max only apply to 2d indexes", spec.IndexName())
+		}
+		if spec.Bits < 0 || spec.Bits > 32 {
+			return fmt.Errorf("index %v: bits must be between 1 and 32", spec.IndexName())
+		}
+		if spec.min() >= spec.max() {
+			return fmt.Errorf("index %v: min must be lower than max", spec.IndexName())
+		}
+	}
+	return nil
+}
+
+// hasField reports whether the key has the field, e.g. "$text:title"
+func (spec *IndexSpec) hasField(field string) bool {
+	for _, f := range spec.Key {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// document returns the index document of createIndexes
+func (spec *IndexSpec) document() (bson.D, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	key, _ := spec.keyDoc()
+	doc := bson.D{{"key", key}, {"name", spec.IndexName()}}
+	if spec.Unique {
+		doc = append(doc, bson.DocElem{"unique", true})
+	}
+	if spec.Sparse {
+		doc = append(doc, bson.DocElem{"sparse", true})
+	}
+	if spec.Background {
+		doc = append(doc, bson.DocElem{"background", true})
+	}
+	if len(spec.PartialFilterExpression) > 0 {
+		doc = append(doc, bson.DocElem{"partialFilterExpression", spec.PartialFilterExpression})
+	}
+	if spec.ExpireAfterSeconds != nil {
+		doc = append(doc, bson.DocElem{"expireAfterSeconds", *spec.ExpireAfterSeconds})
+	}
+	if len(spec.Collation) > 0 {
+		doc = append(doc, bson.DocElem{"collation", spec.Collation})
+	}
+	if len(spec.Weights) > 0 {
+		doc = append(doc, bson.DocElem{"weights", spec.Weights})
+	}
+	if spec.DefaultLanguage != "" {
+		doc = append(doc, bson.DocElem{"default_language", spec.DefaultLanguage})
+	}
+	if spec.LanguageOverride != "" {
+		doc = append(doc, bson.DocElem{"language_override", spec.LanguageOverride})
+	}
+	if spec.SphereIndexVersion != 0 {
+		doc = append(doc, bson.DocElem{"2dsphereIndexVersion", spec.SphereIndexVersion})
+	}
+	if spec.Bits != 0 {
+		doc = append(doc, bson.DocElem{"bits", spec.Bits})
+	}
+	if spec.Min != nil {
+		doc = append(doc, bson.DocElem{"min", *spec.Min})
+	}
+	if spec.Max != nil {
+		doc = append(doc, bson.DocElem{"max", *spec.Max})
+	}
+	return doc, nil
+}
+
+// CreateIndex creates the index on the collection
+// https://docs.mongodb.com/v3.4/reference/command/createIndexes/
+func (ci *CollIndexes) CreateIndex(spec IndexSpec) error {
+	doc, err := spec.document()
+	if err != nil {
+		return err
+	}
+
+	session, err := ci.SessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	cmd := bson.D{{"createIndexes", ci.Options.Collection}, {"indexes", []bson.D{doc}}}
+	result := bson.M{}
+	err = session.DB(ci.Options.DB).Run(cmd, &result)
+	if err != nil {
+		return fmt.Errorf("error creating index %v: %v", spec.IndexName(), err)
+	}
+	return nil
+}
+
+// IndexSpecs returns the indexes of the collection with all their options
+// https://docs.mongodb.com/v3.2/reference/command/listIndexes/
+func (ci *CollIndexes) IndexSpecs() ([]IndexSpec, error) {
+	session, err := ci.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	result := &listIndexesResult{}
+	err = session.DB(ci.Options.DB).Run(bson.D{{"listIndexes", ci.Options.Collection}}, result)
+	if err != nil {
+		return nil, fmt.Errorf("error listing indexes: %v", err)
+	}
+
+	specs := make([]IndexSpec, 0, len(result.Cursor.FirstBatch))
+	for _, index := range result.Cursor.FirstBatch {
+		specs = append(specs, index.spec())
+	}
+	return specs, nil
+}
+
+func (index *liveIndex) spec() IndexSpec {
+	spec := IndexSpec{
+		Name:                    index.Name,
+		Unique:                  index.Unique,
+		Sparse:                  index.Sparse,
+		Background:              index.Background,
+		PartialFilterExpression: index.PartialFilterExpression,
+		ExpireAfterSeconds:      index.ExpireAfterSeconds,
+		Collation:               index.Collation,
+		Weights:                 index.Weights,
+		DefaultLanguage:         index.DefaultLanguage,
+		LanguageOverride:        index.LanguageOverride,
+		SphereIndexVersion:      index.SphereIndexVersion,
+		Bits:                    index.Bits,
+		Min:                     index.Min,
+		Max:                     index.Max,
+	}
+	for _, elem := range index.Key {
+		switch elem.Name {
+		case "_fts":
+			// text indexes store their fields as weights
+			fields := []string{}
+			for field := range index.Weights {
+				fields = append(fields, "$text:"+field)
+			}
+			sort.Strings(fields)
+			spec.Key = append(spec.Key, fields...)
+			continue
+		case "_ftsx":
+			continue
+		}
+		switch value := elem.Value.(type) {
+		case string:
+			spec.Key = append(spec.Key, "$"+value+":"+elem.Name)
+		case int, int32, int64, float64:
+			if fmt.Sprint(value)[0] == '-' {
+				spec.Key = append(spec.Key, "-"+elem.Name)
+			} else {
+				spec.Key = append(spec.Key, elem.Name)
+			}
+		default:
+			spec.Key = append(spec.Key, fmt.Sprintf("$%v:%v", value, elem.Name))
+		}
+	}
+	return spec
+}
@@ -0,0 +1,399 @@
+package collindexes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xkeyideal/mongo-tools/common/db"
+	"github.com/xkeyideal/mongo-tools/common/options"
+	"github.com/xkeyideal/mongo-tools/common/util"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// IndexStats is the usage of an index on one member, as reported by
+// $indexStats.
+type IndexStats struct {
+	Name     string        `bson:"name" json:"name"`
+	Key      bson.D        `bson:"key" json:"key"`
+	Host     string        `bson:"host" json:"host"`
+	Accesses IndexAccesses `bson:"accesses" json:"accesses"`
+}
+
+// IndexAccesses counts the operations using an index since the member
+// started, or since the index was created.
+type IndexAccesses struct {
+	Ops   int64     `bson:"ops" json:"ops"`
+	Since time.Time `bson:"since" json:"since"`
+}
+
+type indexSizesResult struct {
+	IndexSizes map[string]int64 `bson:"indexSizes"`
+}
+
+type isMasterResult struct {
+	SetName string `bson:"setName"`
+	Msg     string `bson:"msg"`
+}
+
+// replSetConfigResult lists every member of a replica set, hidden ones
+// included, which isMaster leaves out.
+type replSetConfigResult struct {
+	Config struct {
+		Members []struct {
+			Host        string `bson:"host"`
+			ArbiterOnly bool   `bson:"arbiterOnly"`
+		} `bson:"members"`
+	} `bson:"config"`
+}
+
+type replSetStatusResult struct {
+	Members []struct {
+		Name  string `bson:"name"`
+		State int    `bson:"state"`
+	} `bson:"members"`
+}
+
+// stateArbiter is the replSetGetStatus state of an arbiter
+const stateArbiter = 7
+
+// shardDoc is a shard as listed in the config.shards collection.
+type shardDoc struct {
+	Id   string `bson:"_id"`
+	Host string `bson:"host"`
+}
+
+// IndexStats returns the usage of the indexes of the collection on the member
+// the session reads from.
+// https://docs.mongodb.com/v3.2/reference/operator/aggregation/indexStats/
+func (ci *CollIndexes) IndexStats() ([]IndexStats, error) {
+	return indexStats(ci.SessionProvider, ci.Options.DB, ci.Options.Collection)
+}
+
+func indexStats(sp *db.SessionProvider, dbName, collection string) ([]IndexStats, error) {
+	session, err := sp.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	stats := []IndexStats{}
+	pipeline := []bson.M{{"$indexStats": bson.M{}}}
+	err = session.DB(dbName).C(collection).Pipe(pipeline).All(&stats)
+	if err != nil {
+		return nil, fmt.Errorf("error running $indexStats on %v.%v: %v", dbName, collection, err)
+	}
+	return stats, nil
+}
+
+// Members returns the data bearing members of the replica set the session
+// is connected to, hidden ones included, or those of every shard behind a
+// mongos. A standalone is returned as is.
+func (ci *CollIndexes) Members() ([]string, error) {
+	session, err := ci.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	result := isMasterResult{}
+	if err := session.Run("isMaster", &result); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case result.Msg == "isdbgrid":
+		shards := []shardDoc{}
+		if err := session.DB("config").C("shards").Find(nil).All(&shards); err != nil {
+			return nil, fmt.Errorf("error listing shards: %v", err)
+		}
+		members := []string{}
+		for _, shard := range shards {
+			shardMembers, err := ci.shardMembers(shard)
+			if err != nil {
+				return nil, fmt.Errorf("error listing the members of shard %v: %v", shard.Id, err)
+			}
+			members = append(members, shardMembers...)
+		}
+		return members, nil
+	case result.SetName != "":
+		return setMembers(session)
+	default:
+		return ci.Options.Addrs, nil
+	}
+}
+
+// shardMembers asks the hosts of a shard for its members, until one of them
+// answers. A shard without a set name is a standalone.
+func (ci *CollIndexes) shardMembers(shard shardDoc) ([]string, error) {
+	seeds, setName := util.ParseConnectionString(shard.Host)
+	if setName == "" {
+		return seeds, nil
+	}
+
+	err := fmt.Errorf("no hosts")
+	for _, seed := range seeds {
+		var sp *db.SessionProvider
+		sp, err = ci.memberSessionProvider(seed)
+		if err != nil {
+			continue
+		}
+		var members []string
+		members, err = providerSetMembers(sp)
+		sp.Close()
+		if err == nil {
+			return members, nil
+		}
+	}
+	return nil, err
+}
+
+func providerSetMembers(sp *db.SessionProvider) ([]string, error) {
+	session, err := sp.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+	return setMembers(session)
+}
+
+// setMembers returns every member but the arbiters of the replica set of the
+// session, from its config, or from its status on servers which predate
+// replSetGetConfig.
+// https://docs.mongodb.com/v3.2/reference/command/replSetGetConfig/
+// https://docs.mongodb.com/v3.2/reference/command/replSetGetStatus/
+func setMembers(session *mgo.Session) ([]string, error) {
+	members := []string{}
+
+	config := replSetConfigResult{}
+	err := session.DB("admin").Run(bson.D{{"replSetGetConfig", 1}}, &config)
+	if err == nil {
+		for _, member := range config.Config.Members {
+			if !member.ArbiterOnly {
+				members = append(members, member.Host)
+			}
+		}
+		return members, nil
+	}
+
+	status := replSetStatusResult{}
+	if statusErr := session.DB("admin").Run(bson.D{{"replSetGetStatus", 1}}, &status); statusErr != nil {
+		return nil, fmt.Errorf("error running replSetGetConfig: %v, and replSetGetStatus: %v", err, statusErr)
+	}
+	for _, member := range status.Members {
+		if member.State != stateArbiter {
+			members = append(members, member.Name)
+		}
+	}
+	return members, nil
+}
+
+// MemberIndexStats returns the usage of the indexes of the collection on
+// every data bearing member, as the counters of $indexStats are kept per
+// member. Every member must answer, as an index unused on the members that
+// did may still serve the reads of the others.
+func (ci *CollIndexes) MemberIndexStats() ([]IndexStats, error) {
+	members, err := ci.Members()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		all      []IndexStats
+		failures []string
+	)
+	for _, member := range members {
+		wg.Add(1)
+		go func(member string) {
+			defer wg.Done()
+			stats, err := ci.memberIndexStats(member)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%v: %v", member, err))
+				return
+			}
+			for i := range stats {
+				// behind a mongos the host is the shard member's
+				if stats[i].Host == "" {
+					stats[i].Host = member
+				}
+			}
+			all = append(all, stats...)
+		}(member)
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return nil, fmt.Errorf("error gathering index stats from %v", strings.Join(failures, "; "))
+	}
+	return all, nil
+}
+
+// memberIndexStats connects directly to member, with the same connection
+// settings as the CollIndexes.
+func (ci *CollIndexes) memberIndexStats(member string) ([]IndexStats, error) {
+	sp, err := ci.memberSessionProvider(member)
+	if err != nil {
+		return nil, err
+	}
+	defer sp.Close()
+
+	return indexStats(sp, ci.Options.DB, ci.Options.Collection)
+}
+
+// memberSessionProvider copies the connection settings of the CollIndexes,
+// but connects directly to member.
+func (ci *CollIndexes) memberSessionProvider(member string) (*db.SessionProvider, error) {
+	optsCopy := options.New(ci.Options.AppName)
+
+	optsCopy.Source = ci.Options.Source
+	optsCopy.Username = ci.Options.Username
+	optsCopy.Password = ci.Options.Password
+	optsCopy.Timeout = ci.Options.Timeout
+	optsCopy.TCPKeepAliveSeconds = ci.Options.TCPKeepAliveSeconds
+
+	optsCopy.Addrs = []string{member}
+	optsCopy.Direct = true
+	return db.NewSessionProvider(optsCopy)
+}
+
+// IndexSizes returns the size in bytes of each index of the collection
+// https://docs.mongodb.com/v3.2/reference/command/collStats/
+func (ci *CollIndexes) IndexSizes() (map[string]int64, error) {
+	session, err := ci.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	result := &indexSizesResult{}
+	err = session.DB(ci.Options.DB).Run(bson.D{{"collStats", ci.Options.Collection}}, result)
+	if err != nil {
+		return nil, fmt.Errorf("error running collStats: %v", err)
+	}
+	return result.IndexSizes, nil
+}
+
+// MemberUsage is the usage of an index on one member.
+type MemberUsage struct {
+	Host  string    `json:"host"`
+	Ops   int64     `json:"ops"`
+	Since time.Time `json:"since"`
+}
+
+// IndexUsage is the usage of an index across every member.
+type IndexUsage struct {
+	Name string `json:"name"`
+	Key  bson.D `json:"key"`
+	Size int64  `json:"size"`
+
+	// Ops is the sum of the operations on every member
+	Ops int64 `json:"ops"`
+
+	// ObservedSince is the latest since of the members, i.e. Ops covers at
+	// least the time since then on every member
+	ObservedSince time.Time `json:"observedSince"`
+
+	Members []MemberUsage `json:"members"`
+}
+
+// IndexUsageReport joins the usage of the indexes across every member with
+// their sizes.
+type IndexUsageReport struct {
+	Namespace string   `json:"namespace"`
+	Members   []string `json:"members"`
+
+	// MaxOps is the threshold at or below which an index counts as unused
+	MaxOps int64 `json:"maxOps"`
+
+	Indexes []*IndexUsage `json:"indexes"`
+
+	// Unused are the indexes with at most MaxOps operations across every
+	// member, largest first. The _id index is never listed, as it cannot be
+	// dropped.
+	Unused []*IndexUsage `json:"unused"`
+
+	// UnusedSize is the total size of the unused indexes
+	UnusedSize int64 `json:"unusedSize"`
+}
+
+// UsageReport gathers the usage of the indexes of the collection from every
+// member, and reports those with at most maxOps operations, 0 for the
+// indexes never used, since the members last restarted.
+func (ci *CollIndexes) UsageReport(maxOps int64) (*IndexUsageReport, error) {
+	stats, err := ci.MemberIndexStats()
+	if err != nil {
+		return nil, err
+	}
+	sizes, err := ci.IndexSizes()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IndexUsageReport{
+		Namespace: ci.Options.DB + "." + ci.Options.Collection,
+		Members:   []string{},
+		MaxOps:    maxOps,
+		Indexes:   []*IndexUsage{},
+		Unused:    []*IndexUsage{},
+	}
+
+	byName := map[string]*IndexUsage{}
+	members := map[string]bool{}
+	for _, stat := range stats {
+		usage, ok := byName[stat.Name]
+		if !ok {
+			usage = &IndexUsage{
+				Name: stat.Name,
+				Key:  stat.Key,
+				Size: sizes[stat.Name],
+			}
+			byName[stat.Name] = usage
+			report.Indexes = append(report.Indexes, usage)
+		}
+		usage.Ops += stat.Accesses.Ops
+		if stat.Accesses.Since.After(usage.ObservedSince) {
+			usage.ObservedSince = stat.Accesses.Since
+		}
+		usage.Members = append(usage.Members, MemberUsage{
+			Host:  stat.Host,
+			Ops:   stat.Accesses.Ops,
+			Since: stat.Accesses.Since,
+		})
+		if !members[stat.Host] {
+			members[stat.Host] = true
+			report.Members = append(report.Members, stat.Host)
+		}
+	}
+	sort.Strings(report.Members)
+
+	sort.Slice(report.Indexes, func(i, j int) bool {
+		return report.Indexes[i].Name < report.Indexes[j].Name
+	})
+	for _, usage := range report.Indexes {
+		sort.Slice(usage.Members, func(i, j int) bool {
+			return usage.Members[i].Host < usage.Members[j].Host
+		})
+		if usage.Name != "_id_" && usage.Ops <= maxOps {
+			report.Unused = append(report.Unused, usage)
+			report.UnusedSize += usage.Size
+		}
+	}
+	sort.SliceStable(report.Unused, func(i, j int) bool {
+		return report.Unused[i].Size > report.Unused[j].Size
+	})
+	return report, nil
+}
@@ -0,0 +1,441 @@
+package collindexes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Sync actions
+const (
+	SyncCreate   = "create"
+	SyncDrop     = "drop"
+	SyncRecreate = "recreate"
+	SyncCollMod  = "collMod"
+
+	// SyncSkip reports a live index which only differs by its name, as
+	// renaming it would take a rebuild, or a spec whose key several live
+	// indexes with other options share, which is left to the operator
+	SyncSkip = "skip"
+)
+
+// SyncAction is a change to bring an index in line with its spec.
+type SyncAction struct {
+	Action string `json:"action"`
+	Name   string `json:"name"`
+
+	// Reason lists the differences of a recreated or modified index
+	Reason string `json:"reason,omitempty"`
+
+	Desired *IndexSpec `json:"desired,omitempty"`
+	Live    *IndexSpec `json:"live,omitempty"`
+
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SyncPlan is the diff between the desired and the live indexes of a
+// collection, in the order it is applied: missing indexes are created
+// first, then mismatched ones are recreated or modified, and extra ones
+// dropped last.
+type SyncPlan struct {
+	Namespace string        `json:"namespace"`
+	DryRun    bool          `json:"dryRun"`
+	Actions   []*SyncAction `json:"actions"`
+}
+
+// String returns the plan one action per line
+func (plan *SyncPlan) String() string {
+	buf := &bytes.Buffer{}
+	mode := "apply"
+	if plan.DryRun {
+		mode = "dry run"
+	}
+	fmt.Fprintf(buf, "%v: %v action(s), %v\n", plan.Namespace, len(plan.Actions), mode)
+	for _, action := range plan.Actions {
+		status := ""
+		switch {
+		case action.Error != "":
+			status = " FAILED: " + action.Error
+		case action.Applied:
+			status = " done"
+		}
+		reason := ""
+		if action.Reason != "" {
+			reason = " (" + action.Reason + ")"
+		}
+		fmt.Fprintf(buf, "%-8v %v%v%v\n", action.Action, action.Name, reason, status)
+	}
+	return buf.String()
+}
+
+// ReadIndexSpecFile reads a JSON array of IndexSpec, in MongoDB extended
+// JSON so that e.g. partial filters can hold dates.
+func ReadIndexSpecFile(path string) ([]IndexSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	specs := []IndexSpec{}
+	if err := bson.UnmarshalJSON(data, &specs); err != nil {
+		return nil, fmt.Errorf("error parsing index spec file %v: %v", path, err)
+	}
+	return specs, nil
+}
+
+// PlanSync returns the actions which bring the indexes of the collection in
+// line with desired. The _id index is never dropped.
+func (ci *CollIndexes) PlanSync(desired []IndexSpec) (*SyncPlan, error) {
+	names := map[string]bool{}
+	for i := range desired {
+		if err := desired[i].Validate(); err != nil {
+			return nil, err
+		}
+		name := desired[i].IndexName()
+		if names[name] {
+			return nil, fmt.Errorf("index %v is specified more than once", name)
+		}
+		names[name] = true
+	}
+
+	live, err := ci.IndexSpecs()
+	if err != nil {
+		return nil, err
+	}
+	return planSync(ci.Options.DB+"."+ci.Options.Collection, desired, live), nil
+}
+
+func planSync(ns string, desired, live []IndexSpec) *SyncPlan {
+	plan := &SyncPlan{Namespace: ns, DryRun: true, Actions: []*SyncAction{}}
+
+	byName := map[string]*IndexSpec{}
+	for i := range live {
+		byName[live[i].Name] = &live[i]
+	}
+	byKey := liveByKey(live, desired)
+
+	matched := map[string]bool{}
+	creates, changes := []*SyncAction{}, []*SyncAction{}
+	for i := range desired {
+		want := &desired[i]
+		name := want.IndexName()
+
+		// an index is matched by its name, or by its key under another name
+		have, ok := byName[name]
+		if !ok {
+			candidates := byKey[keyString(want.Key)]
+			if len(candidates) == 0 {
+				creates = append(creates, &SyncAction{Action: SyncCreate, Name: name, Desired: want})
+				continue
+			}
+			if have = keyMatch(want, candidates, specDiffs); have == nil {
+				for _, candidate := range candidates {
+					matched[candidate.Name] = true
+				}
+				changes = append(changes, &SyncAction{
+					Action:  SyncSkip,
+					Name:    name,
+					Reason:  "key matches indexes " + indexNames(candidates) + " with other options",
+					Desired: want,
+				})
+				continue
+			}
+		}
+		matched[have.Name] = true
+
+		diffs := specDiffs(want, have)
+		if len(diffs) == 0 {
+			continue
+		}
+		action, reason := SyncRecreate, strings.Join(diffs, ", ")+" differ"
+		switch {
+		case len(diffs) == 1 && diffs[0] == "name":
+			action, reason = SyncSkip, "exists as "+have.Name
+		case len(diffs) == 1 && diffs[0] == "expireAfterSeconds" && have.ExpireAfterSeconds != nil && want.ExpireAfterSeconds != nil:
+			// the TTL of an index can be changed in place
+			action = SyncCollMod
+		}
+		changes = append(changes, &SyncAction{
+			Action:  action,
+			Name:    name,
+			Reason:  reason,
+			Desired: want,
+			Live:    have,
+		})
+	}
+
+	drops := []*SyncAction{}
+	for i := range live {
+		if live[i].Name == "_id_" || matched[live[i].Name] {
+			continue
+		}
+		drops = append(drops, &SyncAction{Action: SyncDrop, Name: live[i].Name, Live: &live[i]})
+	}
+	sort.Slice(drops, func(i, j int) bool { return drops[i].Name < drops[j].Name })
+
+	plan.Actions = append(plan.Actions, creates...)
+	plan.Actions = append(plan.Actions, changes...)
+	plan.Actions = append(plan.Actions, drops...)
+	return plan
+}
+
+// liveByKey groups the live indexes by key, leaving out those named as one of
+// specs, which are matched by name.
+func liveByKey(live, specs []IndexSpec) map[string][]*IndexSpec {
+	named := map[string]bool{}
+	for i := range specs {
+		named[specs[i].IndexName()] = true
+	}
+	byKey := map[string][]*IndexSpec{}
+	for i := range live {
+		if named[live[i].Name] {
+			continue
+		}
+		key := keyString(live[i].Key)
+		byKey[key] = append(byKey[key], &live[i])
+	}
+	return byKey
+}
+
+// keyMatch returns the index among the live candidates sharing the key of
+// want which it is compared with: the one that only differs by its name, or
+// else the only candidate. It returns nil if several candidates differ in
+// other options, e.g. their collations, as none of them is the one wanted.
+func keyMatch(want *IndexSpec, candidates []*IndexSpec, diffs func(want, have *IndexSpec) []string) *IndexSpec {
+	for _, have := range candidates {
+		nameOnly := true
+		for _, diff := range diffs(want, have) {
+			if diff != "name" {
+				nameOnly = false
+				break
+			}
+		}
+		if nameOnly {
+			return have
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	return nil
+}
+
+// indexNames returns the names of the indexes, comma separated.
+func indexNames(specs []*IndexSpec) string {
+	names := []string{}
+	for _, spec := range specs {
+		names = append(names, spec.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// specDiffs returns the names of the options in which the live index
+// differs from the desired one. Background is a build option, and only the
+// collation fields given in the desired spec are compared, as the server
+// fills in the others. The text and geo options are compared when the
+// desired spec gives them, against the server defaults if the live index
+// lacks them.
+func specDiffs(want, have *IndexSpec) []string {
+	diffs := []string{}
+	if want.IndexName() != have.Name {
+		diffs = append(diffs, "name")
+	}
+	if keyString(want.Key) != keyString(have.Key) {
+		diffs = append(diffs, "key")
+	}
+	if want.Unique != have.Unique {
+		diffs = append(diffs, "unique")
+	}
+	if want.Sparse != have.Sparse {
+		diffs = append(diffs, "sparse")
+	}
+	if canonical(want.PartialFilterExpression) != canonical(have.PartialFilterExpression) {
+		diffs = append(diffs, "partialFilterExpression")
+	}
+	if (want.ExpireAfterSeconds == nil) != (have.ExpireAfterSeconds == nil) ||
+		(want.ExpireAfterSeconds != nil && *want.ExpireAfterSeconds != *have.ExpireAfterSeconds) {
+		diffs = append(diffs, "expireAfterSeconds")
+	}
+	if len(want.Collation) > 0 {
+		for field, value := range want.Collation {
+			if canonical(value) != canonical(have.Collation[field]) {
+				diffs = append(diffs, "collation")
+				break
+			}
+		}
+	}
+	if len(want.Weights) > 0 && canonical(want.textWeights()) != canonical(have.textWeights()) {
+		diffs = append(diffs, "weights")
+	}
+	if want.DefaultLanguage != "" && want.DefaultLanguage != have.defaultLanguage() {
+		diffs = append(diffs, "default_language")
+	}
+	if want.LanguageOverride != "" && want.LanguageOverride != have.languageOverride() {
+		diffs = append(diffs, "language_override")
+	}
+	if want.SphereIndexVersion != 0 && want.SphereIndexVersion != have.SphereIndexVersion {
+		diffs = append(diffs, "2dsphereIndexVersion")
+	}
+	if want.Bits != 0 && want.Bits != have.bits() {
+		diffs = append(diffs, "bits")
+	}
+	if want.Min != nil && *want.Min != have.min() {
+		diffs = append(diffs, "min")
+	}
+	if want.Max != nil && *want.Max != have.max() {
+		diffs = append(diffs, "max")
+	}
+	return diffs
+}
+
+// keyString returns a comparable form of an index key, with the fields of
+// a text index sorted as the server reports them.
+func keyString(key []string) string {
+	normalized := append([]string{}, key...)
+	for i := 0; i < len(normalized); {
+		j := i
+		for j < len(normalized) && strings.HasPrefix(normalized[j], "$text:") {
+			j++
+		}
+		if j > i {
+			sort.Strings(normalized[i:j])
+			i = j
+		} else {
+			i++
+		}
+	}
+	return strings.Join(normalized, ",")
+}
+
+// canonical returns a comparable form of a document, with its fields sorted
+// and every number as a double, as JSON numbers and BSON integers compare
+// equal on the server.
+func canonical(value interface{}) string {
+	b, err := json.Marshal(canonicalValue(value))
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
+
+func canonicalValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		m := map[string]interface{}{}
+		for _, elem := range v {
+			m[elem.Name] = canonicalValue(elem.Value)
+		}
+		return m
+	case bson.M:
+		m := map[string]interface{}{}
+		for key, elem := range v {
+			m[key] = canonicalValue(elem)
+		}
+		return m
+	case map[string]interface{}:
+		return canonicalValue(bson.M(v))
+	case []interface{}:
+		s := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			s = append(s, canonicalValue(elem))
+		}
+		return s
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	default:
+		return v
+	}
+}
+
+// Sync brings the indexes of the collection in line with desired. With
+// dryRun only the plan is returned. Applying stops at the first failed
+// action, which is marked in the returned plan. Indexes which only differ by
+// their name are left as they are.
+func (ci *CollIndexes) Sync(desired []IndexSpec, dryRun bool) (*SyncPlan, error) {
+	plan, err := ci.PlanSync(desired)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return plan, nil
+	}
+	plan.DryRun = false
+
+	for _, action := range plan.Actions {
+		if action.Action == SyncSkip {
+			continue
+		}
+		if err := ci.apply(action); err != nil {
+			action.Error = err.Error()
+			return plan, fmt.Errorf("error applying %v of index %v: %v", action.Action, action.Name, err)
+		}
+		action.Applied = true
+	}
+	return plan, nil
+}
+
+func (ci *CollIndexes) apply(action *SyncAction) error {
+	switch action.Action {
+	case SyncCreate:
+		return ci.CreateIndex(*action.Desired)
+	case SyncDrop:
+		return ci.DropIndexName(action.Name)
+	case SyncRecreate:
+		return ci.recreate(action.Live, action.Desired)
+	case SyncCollMod:
+		return ci.collModTTL(action.Live.Name, *action.Desired.ExpireAfterSeconds)
+	}
+	return fmt.Errorf("unknown sync action %v", action.Action)
+}
+
+// recreate replaces the live index by the desired one. If the desired index
+// cannot be created once the live one is dropped, the live one is restored,
+// and the error names the dropped index and whether it was restored, so that
+// the collection is not left without it unnoticed.
+func (ci *CollIndexes) recreate(live, desired *IndexSpec) error {
+	if err := ci.DropIndexName(live.Name); err != nil {
+		return err
+	}
+	err := ci.CreateIndex(*desired)
+	if err == nil {
+		return nil
+	}
+
+	restore := *live
+	restore.Background = true
+	if restoreErr := ci.CreateIndex(restore); restoreErr != nil {
+		return fmt.Errorf("index %v was dropped, but creating its replacement failed: %v; "+
+			"restoring it failed too, the collection is left without it: %v", live.Name, err, restoreErr)
+	}
+	return fmt.Errorf("index %v was dropped, but creating its replacement failed, so it was restored: %v", live.Name, err)
+}
+
+// collModTTL changes the expireAfterSeconds of a TTL index in place
+// https://docs.mongodb.com/v3.2/reference/command/collMod/
+func (ci *CollIndexes) collModTTL(name string, expireAfterSeconds int64) error {
+	session, err := ci.SessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	cmd := bson.D{
+		{"collMod", ci.Options.Collection},
+		{"index", bson.D{{"name", name}, {"expireAfterSeconds", expireAfterSeconds}}},
+	}
+	result := bson.M{}
+	return session.DB(ci.Options.DB).Run(cmd, &result)
+}
@@ -0,0 +1,334 @@
+package collindexes
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/xkeyideal/mongo-tools/common/db"
+	"github.com/xkeyideal/mongo-tools/common/options"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// systemDatabases are never exported nor imported
+var systemDatabases = map[string]bool{
+	"admin":  true,
+	"local":  true,
+	"config": true,
+}
+
+// TransferFilter selects the collections whose indexes are exported or
+// imported. Empty lists select everything outside the system databases.
+type TransferFilter struct {
+	Databases []string `json:"databases,omitempty"`
+
+	// Collections are collection names, or full namespaces to select a
+	// collection of one database only
+	Collections []string `json:"collections,omitempty"`
+}
+
+func (f *TransferFilter) matchDB(dbName string) bool {
+	if systemDatabases[dbName] {
+		return false
+	}
+	if f == nil || len(f.Databases) == 0 {
+		return true
+	}
+	for _, name := range f.Databases {
+		if name == dbName {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *TransferFilter) matchCollection(dbName, collection string) bool {
+	if strings.HasPrefix(collection, "system.") {
+		return false
+	}
+	if f == nil || len(f.Collections) == 0 {
+		return true
+	}
+	for _, name := range f.Collections {
+		if name == collection || name == dbName+"."+collection {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectionIndexes are the indexes of one collection
+type CollectionIndexes struct {
+	DB         string      `json:"db"`
+	Collection string      `json:"collection"`
+	Indexes    []IndexSpec `json:"indexes"`
+}
+
+// IndexExport is a portable document of the index definitions of a cluster
+type IndexExport struct {
+	ExportedAt  time.Time            `json:"exportedAt"`
+	Source      []string             `json:"source"`
+	Collections []*CollectionIndexes `json:"collections"`
+
+	// Errors are the collections whose indexes could not be read, e.g.
+	// views, by namespace
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// collIndexesFor returns a CollIndexes of another namespace on the same
+// connection
+func collIndexesFor(opts *options.ToolOptions, sp *db.SessionProvider, dbName, collection string) *CollIndexes {
+	optsCopy := *opts
+	optsCopy.DB = dbName
+	optsCopy.Collection = collection
+	return NewCollIndexes(&optsCopy, sp)
+}
+
+// ExportIndexes walks the databases and collections selected by filter and
+// returns the definitions of their indexes, with all their options.
+func ExportIndexes(opts *options.ToolOptions, sp *db.SessionProvider, filter *TransferFilter) (*IndexExport, error) {
+	dbNames, err := sp.DatabaseNames()
+	if err != nil {
+		return nil, fmt.Errorf("error listing databases: %v", err)
+	}
+
+	export := &IndexExport{
+		ExportedAt:  time.Now(),
+		Source:      opts.Addrs,
+		Collections: []*CollectionIndexes{},
+		Errors:      map[string]string{},
+	}
+	for _, dbName := range dbNames {
+		if !filter.matchDB(dbName) {
+			continue
+		}
+		collections, err := sp.CollectionNames(dbName)
+		if err != nil {
+			return nil, fmt.Errorf("error listing collections of %v: %v", dbName, err)
+		}
+		for _, collection := range collections {
+			if !filter.matchCollection(dbName, collection) {
+				continue
+			}
+			specs, err := collIndexesFor(opts, sp, dbName, collection).IndexSpecs()
+			if err != nil {
+				export.Errors[dbName+"."+collection] = err.Error()
+				continue
+			}
+			export.Collections = append(export.Collections, &CollectionIndexes{
+				DB:         dbName,
+				Collection: collection,
+				Indexes:    specs,
+			})
+		}
+	}
+	return export, nil
+}
+
+// WriteIndexExport writes the export to path as MongoDB extended JSON, so
+// that values such as dates in partial filters survive the trip.
+func WriteIndexExport(path string, export *IndexExport) error {
+	data, err := bson.MarshalJSON(export)
+	if err != nil {
+		return fmt.Errorf("error converting index export to JSON: %v", err)
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// ReadIndexExport reads an export written by WriteIndexExport
+func ReadIndexExport(path string) (*IndexExport, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	export := &IndexExport{}
+	if err := bson.UnmarshalJSON(data, export); err != nil {
+		return nil, fmt.Errorf("error parsing index export %v: %v", path, err)
+	}
+	return export, nil
+}
+
+// Import actions
+const (
+	ImportCreate   = "create"
+	ImportSkip     = "skip"
+	ImportConflict = "conflict"
+)
+
+// ImportAction is what an import does with one exported index. Existing
+// identical indexes are skipped, and existing indexes with the same name or
+// key but other options are conflicts, which are reported and left as they
+// are.
+type ImportAction struct {
+	Namespace string `json:"namespace"`
+	Action    string `json:"action"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason,omitempty"`
+
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+
+	spec IndexSpec
+}
+
+// ImportReport lists the actions of an import
+type ImportReport struct {
+	DryRun  bool            `json:"dryRun"`
+	Actions []*ImportAction `json:"actions"`
+
+	Created   int `json:"created"`
+	Skipped   int `json:"skipped"`
+	Conflicts int `json:"conflicts"`
+	Failed    int `json:"failed"`
+}
+
+// String returns the report one action per line
+func (report *ImportReport) String() string {
+	buf := &bytes.Buffer{}
+	mode := "applied"
+	if report.DryRun {
+		mode = "dry run"
+	}
+	fmt.Fprintf(buf, "%v create, %v skip, %v conflict, %v failed (%v)\n",
+		report.Created, report.Skipped, report.Conflicts, report.Failed, mode)
+	for _, action := range report.Actions {
+		line := fmt.Sprintf("%-8v %v %v", action.Action, action.Namespace, action.Name)
+		if action.Reason != "" {
+			line += " (" + action.Reason + ")"
+		}
+		if action.Error != "" {
+			line += " FAILED: " + action.Error
+		}
+		fmt.Fprintln(buf, line)
+	}
+	return buf.String()
+}
+
+// ImportIndexes creates the exported indexes selected by filter on the
+// cluster sp connects to. With dryRun nothing is created, and the report
+// tells what would be. Missing collections are created with their indexes.
+func ImportIndexes(opts *options.ToolOptions, sp *db.SessionProvider, export *IndexExport,
+	filter *TransferFilter, dryRun bool) (*ImportReport, error) {
+
+	report := &ImportReport{DryRun: dryRun, Actions: []*ImportAction{}}
+	existing := map[string]map[string]bool{}
+
+	for _, coll := range export.Collections {
+		if !filter.matchDB(coll.DB) || !filter.matchCollection(coll.DB, coll.Collection) {
+			continue
+		}
+		ns := coll.DB + "." + coll.Collection
+
+		if _, ok := existing[coll.DB]; !ok {
+			names, err := sp.CollectionNames(coll.DB)
+			if err != nil {
+				return nil, fmt.Errorf("error listing collections of %v: %v", coll.DB, err)
+			}
+			existing[coll.DB] = map[string]bool{}
+			for _, name := range names {
+				existing[coll.DB][name] = true
+			}
+		}
+
+		ci := collIndexesFor(opts, sp, coll.DB, coll.Collection)
+		live := []IndexSpec{}
+		if existing[coll.DB][coll.Collection] {
+			var err error
+			live, err = ci.IndexSpecs()
+			if err != nil {
+				return nil, fmt.Errorf("error reading indexes of %v: %v", ns, err)
+			}
+		}
+
+		for _, action := range importActions(ns, coll.Indexes, live) {
+			report.Actions = append(report.Actions, action)
+			switch action.Action {
+			case ImportSkip:
+				report.Skipped++
+				continue
+			case ImportConflict:
+				report.Conflicts++
+				continue
+			}
+			if dryRun {
+				report.Created++
+				continue
+			}
+			if err := ci.CreateIndex(action.spec); err != nil {
+				action.Error = err.Error()
+				report.Failed++
+				continue
+			}
+			action.Applied = true
+			report.Created++
+		}
+	}
+	return report, nil
+}
+
+// importActions compares the exported indexes of a collection with its live
+// ones. The _id index always exists, and is skipped unless its options
+// differ. As an export holds every option of the source index, an option
+// either side lacks is compared as the server default, so that e.g. a text
+// index with other weights is a conflict rather than skipped.
+func importActions(ns string, exported, live []IndexSpec) []*ImportAction {
+	byName := map[string]*IndexSpec{}
+	for i := range live {
+		byName[live[i].Name] = &live[i]
+	}
+	byKey := liveByKey(live, exported)
+
+	actions := []*ImportAction{}
+	for _, spec := range exported {
+		// the build option of the source does not matter
+		spec.Background = false
+		name := spec.IndexName()
+		action := &ImportAction{Namespace: ns, Name: name, spec: spec}
+		actions = append(actions, action)
+
+		have, ok := byName[name]
+		candidates := byKey[keyString(spec.Key)]
+		if !ok && len(candidates) > 0 {
+			have = keyMatch(&spec, candidates, exactSpecDiffs)
+			ok = true
+		}
+		switch {
+		case !ok && name == "_id_":
+			action.Action = ImportSkip
+		case !ok:
+			action.Action = ImportCreate
+		case have == nil:
+			action.Action = ImportConflict
+			action.Reason = fmt.Sprintf("existing indexes %v: key matches with other options", indexNames(candidates))
+		default:
+			diffs := exactSpecDiffs(&spec, have)
+			if len(diffs) == 0 {
+				action.Action = ImportSkip
+				continue
+			}
+			action.Action = ImportConflict
+			action.Reason = fmt.Sprintf("existing index %v: %v differ", have.Name, strings.Join(diffs, ", "))
+		}
+	}
+	return actions
+}
+
+// exactSpecDiffs returns the names of the options in which two indexes
+// differ, each option compared whichever of them gives it.
+func exactSpecDiffs(exported, live *IndexSpec) []string {
+	diffs := specDiffs(exported, live)
+	seen := map[string]bool{}
+	for _, diff := range diffs {
+		seen[diff] = true
+	}
+	for _, diff := range specDiffs(live, exported) {
+		if !seen[diff] {
+			seen[diff] = true
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
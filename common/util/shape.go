@@ -0,0 +1,141 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Shape returns a copy of a query or command document with every value
+// replaced by the name of its BSON type, e.g. {a: {$gt: 5}} becomes
+// {a: {$gt: "int"}}, so that operations differing only in their values have
+// the same shape. Field names and operators are kept, and the elements of an
+// array are reduced to their distinct shapes.
+func Shape(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		shape := make(bson.D, 0, len(v))
+		for _, elem := range v {
+			shape = append(shape, bson.DocElem{Name: elem.Name, Value: Shape(elem.Value)})
+		}
+		return shape
+	case bson.M:
+		return shapeMap(v)
+	case map[string]interface{}:
+		return shapeMap(v)
+	case []interface{}:
+		shape := []interface{}{}
+		seen := map[string]bool{}
+		for _, elem := range v {
+			elemShape := Shape(elem)
+			key := ShapeString(elemShape)
+			if !seen[key] {
+				seen[key] = true
+				shape = append(shape, elemShape)
+			}
+		}
+		return shape
+	default:
+		return BSONTypeName(value)
+	}
+}
+
+// shapeMap returns the shape of an unordered document, with its fields
+// sorted so that equal shapes compare equal.
+func shapeMap(m map[string]interface{}) bson.D {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	shape := make(bson.D, 0, len(m))
+	for _, key := range keys {
+		shape = append(shape, bson.DocElem{Name: key, Value: Shape(m[key])})
+	}
+	return shape
+}
+
+// ShapeString renders a shape in a compact, shell like notation, suitable
+// for grouping operations by their shape.
+func ShapeString(shape interface{}) string {
+	buf := &bytes.Buffer{}
+	writeShape(buf, shape)
+	return buf.String()
+}
+
+func writeShape(buf *bytes.Buffer, shape interface{}) {
+	switch v := shape.(type) {
+	case bson.D:
+		buf.WriteString("{")
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			fmt.Fprintf(buf, "%v: ", elem.Name)
+			writeShape(buf, elem.Value)
+		}
+		buf.WriteString("}")
+	case []interface{}:
+		buf.WriteString("[")
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			writeShape(buf, elem)
+		}
+		buf.WriteString("]")
+	case string:
+		buf.WriteString(v)
+	default:
+		writeShape(buf, Shape(v))
+	}
+}
+
+// BSONTypeName returns the name of the BSON type a value is decoded from.
+func BSONTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string, bson.Symbol:
+		return "string"
+	case int:
+		return "int"
+	case int32:
+		return "int"
+	case int64:
+		return "long"
+	case float64, float32:
+		return "double"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "date"
+	case bson.ObjectId:
+		return "objectId"
+	case bson.RegEx:
+		return "regex"
+	case bson.Binary, []byte:
+		return "binData"
+	case bson.MongoTimestamp:
+		return "timestamp"
+	case bson.Decimal128:
+		return "decimal"
+	case bson.JavaScript:
+		return "javascript"
+	case bson.D, bson.M, map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if value == bson.MinKey {
+		return "minKey"
+	}
+	if value == bson.MaxKey {
+		return "maxKey"
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", value), "bson.")
+}
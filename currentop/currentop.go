@@ -0,0 +1,152 @@
+package currentop
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xkeyideal/mongo-tools/common/db"
+	"github.com/xkeyideal/mongo-tools/common/util"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Operation is an in progress operation as reported by currentOp.
+type Operation struct {
+	Opid             interface{} `bson:"opid" json:"opid"`
+	Active           bool        `bson:"active" json:"active"`
+	SecsRunning      int64       `bson:"secs_running" json:"secs_running"`
+	MicrosecsRunning int64       `bson:"microsecs_running" json:"microsecs_running"`
+	Op               string      `bson:"op" json:"op"`
+	Ns               string      `bson:"ns" json:"ns"`
+	Query            bson.D      `bson:"query,omitempty" json:"query,omitempty"`
+	Command          bson.D      `bson:"command,omitempty" json:"command,omitempty"`
+	PlanSummary      string      `bson:"planSummary,omitempty" json:"planSummary,omitempty"`
+	Client           string      `bson:"client,omitempty" json:"client,omitempty"`
+	AppName          string      `bson:"appName,omitempty" json:"appName,omitempty"`
+	Desc             string      `bson:"desc,omitempty" json:"desc,omitempty"`
+	ConnectionId     int64       `bson:"connectionId,omitempty" json:"connectionId,omitempty"`
+	WaitingForLock   bool        `bson:"waitingForLock" json:"waitingForLock"`
+	NumYields        int64       `bson:"numYields" json:"numYields"`
+	Msg              string      `bson:"msg,omitempty" json:"msg,omitempty"`
+	KillPending      bool        `bson:"killPending,omitempty" json:"killPending,omitempty"`
+
+	// QueryShape is the query, or the command on 3.2+, with its values
+	// replaced by their types
+	QueryShape string `bson:"-" json:"queryShape,omitempty"`
+}
+
+type currentOpResult struct {
+	Inprog []Operation `bson:"inprog"`
+}
+
+// Filter selects the operations reported by currentOp. Zero values match
+// every operation.
+type Filter struct {
+	// Namespace is either a full namespace or a database name
+	Namespace string `json:"namespace,omitempty"`
+
+	// OpTypes are the op types to match, e.g. query, update or command
+	OpTypes []string `json:"opTypes,omitempty"`
+
+	// MinSecsRunning matches operations running for at least this long
+	MinSecsRunning int64 `json:"minSecsRunning,omitempty"`
+
+	WaitingForLock bool `json:"waitingForLock,omitempty"`
+
+	// Client matches the client address, with or without the port
+	Client string `json:"client,omitempty"`
+
+	AppName string `json:"appName,omitempty"`
+
+	// All includes idle connections and system operations
+	All bool `json:"all,omitempty"`
+}
+
+// document returns the currentOp command for the filter
+func (f *Filter) document() bson.D {
+	cmd := bson.D{{"currentOp", 1}}
+	if f == nil {
+		return cmd
+	}
+	if f.All {
+		cmd = append(cmd, bson.DocElem{"$all", true})
+	}
+	if f.Namespace != "" {
+		if strings.Contains(f.Namespace, ".") {
+			cmd = append(cmd, bson.DocElem{"ns", f.Namespace})
+		} else {
+			cmd = append(cmd, bson.DocElem{"ns", bson.RegEx{Pattern: "^" + regexp.QuoteMeta(f.Namespace) + `\.`}})
+		}
+	}
+	if len(f.OpTypes) > 0 {
+		cmd = append(cmd, bson.DocElem{"op", bson.M{"$in": f.OpTypes}})
+	}
+	if f.MinSecsRunning > 0 {
+		cmd = append(cmd, bson.DocElem{"secs_running", bson.M{"$gte": f.MinSecsRunning}})
+	}
+	if f.WaitingForLock {
+		cmd = append(cmd, bson.DocElem{"waitingForLock", true})
+	}
+	if f.Client != "" {
+		if strings.Contains(f.Client, ":") {
+			cmd = append(cmd, bson.DocElem{"client", f.Client})
+		} else {
+			cmd = append(cmd, bson.DocElem{"client", bson.RegEx{Pattern: "^" + regexp.QuoteMeta(f.Client) + ":"}})
+		}
+	}
+	if f.AppName != "" {
+		cmd = append(cmd, bson.DocElem{"appName", f.AppName})
+	}
+	return cmd
+}
+
+// validate checks the database of the namespace only, as commands run on
+// pseudo collections such as db.$cmd
+func (f *Filter) validate() error {
+	if f == nil || f.Namespace == "" {
+		return nil
+	}
+	return util.ValidateDBName(strings.SplitN(f.Namespace, ".", 2)[0])
+}
+
+type CurrentOp struct {
+	// for connecting to the db
+	SessionProvider *db.SessionProvider
+}
+
+func NewCurrentOp(sp *db.SessionProvider) *CurrentOp {
+	return &CurrentOp{
+		SessionProvider: sp,
+	}
+}
+
+// https://docs.mongodb.com/v3.2/reference/method/db.currentOp/
+func (c *CurrentOp) Run(filter *Filter) ([]Operation, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+
+	session, err := c.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	result := &currentOpResult{}
+	err = session.DB("admin").Run(filter.document(), result)
+	if err != nil {
+		return nil, fmt.Errorf("error running currentOp: %v", err)
+	}
+
+	for i := range result.Inprog {
+		op := &result.Inprog[i]
+		if len(op.Command) > 0 {
+			op.QueryShape = util.ShapeString(util.Shape(op.Command))
+		} else if len(op.Query) > 0 {
+			op.QueryShape = util.ShapeString(util.Shape(op.Query))
+		}
+	}
+	return result.Inprog, nil
+}
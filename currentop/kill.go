@@ -0,0 +1,283 @@
+package currentop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// protectedDescPrefixes are the thread descriptions of replication and
+// internal server operations, which KillOps refuses to kill
+var protectedDescPrefixes = []string{
+	"repl",
+	"rsBackgroundSync",
+	"rsSync",
+	"rsGhostSync",
+	"SyncSourceFeedback",
+	"NoopWriter",
+	"ApplyBatchFinalizer",
+	"WT",
+	"TTLMonitor",
+	"clientcursormon",
+	"PeriodicTask",
+	"ftdc",
+	"initandlisten",
+	"monitoring keys",
+	"Balancer",
+	"LogicalSessionCache",
+}
+
+// KillRequest selects the operations to kill. Either Opids or a Filter must
+// be given. Killing the operations of a Filter must be confirmed with what a
+// dry run of it reported, as it may match more operations than expected.
+// Nothing is killed unless Execute is true.
+type KillRequest struct {
+	Opids []interface{} `json:"opids,omitempty"`
+
+	Filter *Filter `json:"filter,omitempty"`
+
+	// Confirm is required to kill the operations matched by Filter
+	Confirm *FilterConfirmation `json:"confirm,omitempty"`
+
+	// Execute kills the operations, otherwise the request is a dry run
+	Execute bool `json:"execute"`
+}
+
+// FilterConfirmation guards a kill by filter: the operations the filter
+// matches, but for those refused, must be exactly the Opids of the dry run.
+// Otherwise nothing is killed, so that operations which started since the
+// dry run are not killed unseen.
+type FilterConfirmation struct {
+	Opids []interface{} `json:"opids"`
+}
+
+// Confirmation returns the confirmation of the operations a dry run would
+// have killed. It is meant to be shown to whoever confirms the kill, not to
+// be passed back unseen.
+func (audit *KillAudit) Confirmation() *FilterConfirmation {
+	confirm := &FilterConfirmation{}
+	for _, op := range audit.Killed {
+		confirm.Opids = append(confirm.Opids, op.Opid)
+	}
+	return confirm
+}
+
+// check returns an error unless the operations to kill are those confirmed.
+func (confirm *FilterConfirmation) check(ops []*Operation) error {
+	confirmed := map[string]bool{}
+	for _, opid := range confirm.Opids {
+		confirmed[opidKey(opid)] = true
+	}
+	var unconfirmed []string
+	for _, op := range ops {
+		key := opidKey(op.Opid)
+		if !confirmed[key] {
+			unconfirmed = append(unconfirmed, key)
+		}
+		delete(confirmed, key)
+	}
+	if len(unconfirmed) > 0 {
+		return fmt.Errorf("the filter matches operations which were not confirmed: %v", strings.Join(unconfirmed, ", "))
+	}
+	if len(confirmed) > 0 {
+		var gone []string
+		for key := range confirmed {
+			gone = append(gone, key)
+		}
+		sort.Strings(gone)
+		return fmt.Errorf("the filter no longer matches confirmed operations: %v", strings.Join(gone, ", "))
+	}
+	return nil
+}
+
+// KilledOp is an operation which was, or in a dry run would be, killed.
+type KilledOp struct {
+	Opid        interface{} `json:"opid"`
+	Op          string      `json:"op"`
+	Ns          string      `json:"ns"`
+	Client      string      `json:"client,omitempty"`
+	AppName     string      `json:"appName,omitempty"`
+	SecsRunning int64       `json:"secs_running"`
+	QueryShape  string      `json:"queryShape,omitempty"`
+}
+
+// SkippedOp is an operation which was not killed, and why.
+type SkippedOp struct {
+	KilledOp
+	Reason string `json:"reason"`
+}
+
+// KillAudit records what a KillOps request did.
+type KillAudit struct {
+	Time    time.Time    `json:"time"`
+	DryRun  bool         `json:"dryRun"`
+	Request *KillRequest `json:"request"`
+
+	// Killed are the killed operations, or in a dry run the operations
+	// which would have been killed
+	Killed []KilledOp `json:"killed"`
+
+	Refused  []SkippedOp `json:"refused,omitempty"`
+	Failed   []SkippedOp `json:"failed,omitempty"`
+	NotFound []string    `json:"notFound,omitempty"`
+}
+
+// WriteTo appends the audit as one line of JSON to w, e.g. an audit log.
+func (audit *KillAudit) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.Marshal(audit)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+func newKilledOp(op *Operation) KilledOp {
+	return KilledOp{
+		Opid:        op.Opid,
+		Op:          op.Op,
+		Ns:          op.Ns,
+		Client:      op.Client,
+		AppName:     op.AppName,
+		SecsRunning: op.SecsRunning,
+		QueryShape:  op.QueryShape,
+	}
+}
+
+// protectedReason returns why an operation must not be killed, or "" if it
+// may be.
+func protectedReason(op *Operation) string {
+	if op.KillPending {
+		return "kill already pending"
+	}
+	if op.Ns == "local.oplog.rs" || op.Ns == "local.oplog.$main" {
+		return "oplog operation"
+	}
+	if strings.HasPrefix(op.Ns, "local.") {
+		return "replication operation on the local database"
+	}
+	for _, prefix := range protectedDescPrefixes {
+		if strings.HasPrefix(op.Desc, prefix) {
+			return fmt.Sprintf("internal operation (%v)", op.Desc)
+		}
+	}
+	// client connections are described as conn<id>, internal threads have
+	// no client
+	if op.Client == "" && !strings.HasPrefix(op.Desc, "conn") {
+		return "internal operation without a client"
+	}
+	return ""
+}
+
+// opidKey normalises an opid, which may be decoded as an int, a float or a
+// string ("shard:opid" on mongos), for matching.
+func opidKey(opid interface{}) string {
+	if f, ok := opid.(float64); ok {
+		return fmt.Sprint(int64(f))
+	}
+	return fmt.Sprint(opid)
+}
+
+// KillOps kills the operations selected by the request, refusing to kill
+// replication and internal operations, and returns an audit of what was done.
+// The request is a dry run unless Execute is set; a kill by filter must be
+// confirmed with the opids its dry run reported.
+// https://docs.mongodb.com/v3.2/reference/method/db.killOp/
+func (c *CurrentOp) KillOps(req *KillRequest) (*KillAudit, error) {
+	if req == nil || (len(req.Opids) == 0 && req.Filter == nil) {
+		return nil, errors.New("an opid list or a filter is required")
+	}
+	if req.Filter != nil && req.Execute && req.Confirm == nil {
+		return nil, errors.New("killing the operations matched by a filter must be confirmed with the result of a dry run")
+	}
+	if req.Confirm != nil && len(req.Confirm.Opids) == 0 {
+		return nil, errors.New("a confirmation requires the opids of a dry run")
+	}
+
+	// system operations are only reported with $all
+	filter := Filter{}
+	if req.Filter != nil {
+		filter = *req.Filter
+	}
+	filter.All = true
+	ops, err := c.Run(&filter)
+	if err != nil {
+		return nil, err
+	}
+
+	audit := &KillAudit{
+		Time:    time.Now(),
+		DryRun:  !req.Execute,
+		Request: req,
+		Killed:  []KilledOp{},
+	}
+
+	candidates := []*Operation{}
+	if len(req.Opids) > 0 {
+		byOpid := map[string]*Operation{}
+		for i := range ops {
+			byOpid[opidKey(ops[i].Opid)] = &ops[i]
+		}
+		for _, opid := range req.Opids {
+			op, ok := byOpid[opidKey(opid)]
+			if !ok {
+				audit.NotFound = append(audit.NotFound, opidKey(opid))
+				continue
+			}
+			candidates = append(candidates, op)
+		}
+	} else {
+		for i := range ops {
+			candidates = append(candidates, &ops[i])
+		}
+	}
+
+	killable := []*Operation{}
+	for _, op := range candidates {
+		if reason := protectedReason(op); reason != "" {
+			audit.Refused = append(audit.Refused, SkippedOp{newKilledOp(op), reason})
+			continue
+		}
+		killable = append(killable, op)
+	}
+	if req.Filter != nil && req.Confirm != nil {
+		if err := req.Confirm.check(killable); err != nil {
+			return nil, fmt.Errorf("confirmation does not match, nothing was killed: %v", err)
+		}
+	}
+	if len(killable) == 0 {
+		return audit, nil
+	}
+
+	var session *mgo.Session
+	if req.Execute {
+		session, err = c.SessionProvider.GetSession()
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+		session.SetSocketTimeout(0)
+	}
+
+	for _, op := range killable {
+		if !req.Execute {
+			audit.Killed = append(audit.Killed, newKilledOp(op))
+			continue
+		}
+		result := bson.M{}
+		err := session.DB("admin").Run(bson.D{{"killOp", 1}, {"op", op.Opid}}, &result)
+		if err != nil {
+			audit.Failed = append(audit.Failed, SkippedOp{newKilledOp(op), err.Error()})
+			continue
+		}
+		audit.Killed = append(audit.Killed, newKilledOp(op))
+	}
+	return audit, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/xkeyideal/mongo-tools/common/db"
+	"github.com/xkeyideal/mongo-tools/common/options"
+	"github.com/xkeyideal/mongo-tools/currentop"
+)
+
+func main() {
+	opts := options.New("mongocurrentop")
+	opts.Addrs = []string{"127.0.0.1:27017"}
+	opts.Source = "admin"
+	opts.Username = "root"
+	opts.Password = "123456789"
+	opts.Timeout = 2
+	opts.TCPKeepAliveSeconds = 2
+
+	sessionProvider, err := db.NewSessionProvider(opts)
+	if err != nil {
+		os.Exit(-1)
+	}
+	defer sessionProvider.Close()
+
+	filter := &currentop.Filter{
+		Namespace:      "MongoReplTest",
+		MinSecsRunning: 10,
+	}
+
+	cur := currentop.NewCurrentOp(sessionProvider)
+	ops, err := cur.Run(filter)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	b, _ := json.Marshal(ops)
+	fmt.Println(string(b))
+
+	// dry run, nothing is killed until Execute is set
+	audit, err := cur.KillOps(&currentop.KillRequest{
+		Filter: filter,
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	audit.WriteTo(os.Stdout)
+
+	// the operations of the dry run are confirmed by passing their opids as
+	// arguments, and nothing is killed if the filter now matches others
+	if len(os.Args) < 2 {
+		fmt.Println("to kill these operations, run again with their opids as arguments")
+		return
+	}
+	confirm := &currentop.FilterConfirmation{}
+	for _, opid := range os.Args[1:] {
+		confirm.Opids = append(confirm.Opids, opid)
+	}
+	audit, err = cur.KillOps(&currentop.KillRequest{
+		Filter:  filter,
+		Confirm: confirm,
+		Execute: true,
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	audit.WriteTo(os.Stdout)
+}
@@ -0,0 +1,73 @@
+// Package mongolog parses mongod log files offline, without access to the
+// cluster. It reads the text logs of 3.2/3.4 and the JSON logs of 4.4+, and
+// extracts slow operations, connection events and replica set state
+// transitions.
+package mongolog
+
+import (
+	"time"
+)
+
+// Event is an event extracted from a log line: a *SlowOp, a *ConnEvent or a
+// *StateChange.
+type Event interface {
+	EventTime() time.Time
+}
+
+// SlowOp is an operation logged for exceeding slowms.
+type SlowOp struct {
+	Time    time.Time `json:"time"`
+	Context string    `json:"context"`
+
+	// Op is the op type, e.g. query, update or command
+	Op string `json:"op"`
+
+	// Command is the command name for op command, e.g. find or aggregate
+	Command string `json:"command,omitempty"`
+
+	Ns             string `json:"ns"`
+	DurationMillis int64  `json:"durationMillis"`
+	PlanSummary    string `json:"planSummary,omitempty"`
+	KeysExamined   int64  `json:"keysExamined"`
+	DocsExamined   int64  `json:"docsExamined"`
+	NReturned      int64  `json:"nreturned"`
+}
+
+func (op *SlowOp) EventTime() time.Time {
+	return op.Time
+}
+
+// Name is the command name of a command, otherwise the op type
+func (op *SlowOp) Name() string {
+	if op.Command != "" {
+		return op.Command
+	}
+	return op.Op
+}
+
+// ConnEvent is a connection accepted or ended by the server.
+type ConnEvent struct {
+	Time     time.Time `json:"time"`
+	Accepted bool      `json:"accepted"`
+	Remote   string    `json:"remote"`
+	ConnId   int64     `json:"connectionId"`
+
+	// Open is the number of connections open after the event
+	Open int64 `json:"open"`
+}
+
+func (ce *ConnEvent) EventTime() time.Time {
+	return ce.Time
+}
+
+// StateChange is a replica set member state transition. From is empty in
+// the logs of 3.2, which only name the new state.
+type StateChange struct {
+	Time time.Time `json:"time"`
+	From string    `json:"from,omitempty"`
+	To   string    `json:"to"`
+}
+
+func (sc *StateChange) EventTime() time.Time {
+	return sc.Time
+}
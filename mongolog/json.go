@@ -0,0 +1,141 @@
+package mongolog
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// Messages of the 4.4+ structured log
+const (
+	msgSlowQuery          = "Slow query"
+	msgConnectionAccepted = "Connection accepted"
+	msgConnectionEnded    = "Connection ended"
+	msgStateTransition    = "Replica set state transition"
+)
+
+var jsonMessages = [][]byte{
+	[]byte(msgSlowQuery),
+	[]byte(msgConnectionAccepted),
+	[]byte(msgConnectionEnded),
+	[]byte(msgStateTransition),
+}
+
+// jsonLine is a line of the 4.4+ structured log, e.g.
+// {"t":{"$date":"2020-11-04T10:00:00.123+08:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{...}}
+type jsonLine struct {
+	T struct {
+		Date string `json:"$date"`
+	} `json:"t"`
+	Ctx  string          `json:"ctx"`
+	Msg  string          `json:"msg"`
+	Attr json.RawMessage `json:"attr"`
+}
+
+type slowQueryAttr struct {
+	Type           string          `json:"type"`
+	Ns             string          `json:"ns"`
+	Command        json.RawMessage `json:"command"`
+	PlanSummary    string          `json:"planSummary"`
+	KeysExamined   int64           `json:"keysExamined"`
+	DocsExamined   int64           `json:"docsExamined"`
+	NReturned      int64           `json:"nreturned"`
+	DurationMillis int64           `json:"durationMillis"`
+}
+
+type connectionAttr struct {
+	Remote          string `json:"remote"`
+	ConnectionId    int64  `json:"connectionId"`
+	ConnectionCount int64  `json:"connectionCount"`
+}
+
+type stateTransitionAttr struct {
+	NewState string `json:"newState"`
+	OldState string `json:"oldState"`
+}
+
+// parseJSONLine returns the event of a structured log line, or nil if the
+// line has none.
+func parseJSONLine(line []byte) Event {
+	// most lines have none of the messages, skip them without decoding
+	interesting := false
+	for _, msg := range jsonMessages {
+		if bytes.Contains(line, msg) {
+			interesting = true
+			break
+		}
+	}
+	if !interesting {
+		return nil
+	}
+
+	parsed := jsonLine{}
+	if err := json.Unmarshal(line, &parsed); err != nil {
+		return nil
+	}
+	switch parsed.Msg {
+	case msgSlowQuery, msgConnectionAccepted, msgConnectionEnded, msgStateTransition:
+	default:
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, parsed.T.Date)
+	if err != nil {
+		return nil
+	}
+
+	switch parsed.Msg {
+	case msgSlowQuery:
+		attr := slowQueryAttr{}
+		if err := json.Unmarshal(parsed.Attr, &attr); err != nil {
+			return nil
+		}
+		op := &SlowOp{
+			Time:           t,
+			Context:        parsed.Ctx,
+			Op:             attr.Type,
+			Ns:             attr.Ns,
+			DurationMillis: attr.DurationMillis,
+			PlanSummary:    attr.PlanSummary,
+			KeysExamined:   attr.KeysExamined,
+			DocsExamined:   attr.DocsExamined,
+			NReturned:      attr.NReturned,
+		}
+		if op.Op == "command" {
+			op.Command = firstKey(attr.Command)
+		}
+		return op
+	case msgConnectionAccepted, msgConnectionEnded:
+		attr := connectionAttr{}
+		if err := json.Unmarshal(parsed.Attr, &attr); err != nil {
+			return nil
+		}
+		return &ConnEvent{
+			Time:     t,
+			Accepted: parsed.Msg == msgConnectionAccepted,
+			Remote:   attr.Remote,
+			ConnId:   attr.ConnectionId,
+			Open:     attr.ConnectionCount,
+		}
+	default:
+		attr := stateTransitionAttr{}
+		if err := json.Unmarshal(parsed.Attr, &attr); err != nil {
+			return nil
+		}
+		return &StateChange{Time: t, From: attr.OldState, To: attr.NewState}
+	}
+}
+
+// firstKey returns the first key of a JSON object, i.e. the name of a
+// command, which a map would lose.
+func firstKey(raw json.RawMessage) string {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return ""
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return ""
+	}
+	key, _ := tok.(string)
+	return key
+}
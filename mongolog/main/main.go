@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/xkeyideal/mongo-tools/mongolog"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println("usage: mongolog <mongod.log> [--json]")
+		os.Exit(1)
+	}
+
+	f, err := os.Open(os.Args[1])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	summary, err := mongolog.Analyze(f)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if len(os.Args) > 2 && os.Args[2] == "--json" {
+		fmt.Println(summary.JSON())
+		return
+	}
+	fmt.Print(summary.Grid())
+}
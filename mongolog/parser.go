@@ -0,0 +1,86 @@
+package mongolog
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// DefaultMaxLineSize is the longest line a Parser reads, longer lines are
+// skipped.
+const DefaultMaxLineSize = 4 * 1024 * 1024
+
+// Parser streams the events of a log, text or JSON, line by line. Memory
+// use is bounded by the maximum line size, whatever the size of the log.
+type Parser struct {
+	r *bufio.Reader
+
+	// Lines counts the lines read, Oversized the lines skipped for being
+	// longer than the maximum line size
+	Lines     int64
+	Oversized int64
+}
+
+func NewParser(r io.Reader) *Parser {
+	return NewParserSize(r, DefaultMaxLineSize)
+}
+
+// NewParserSize returns a Parser skipping lines longer than maxLineSize
+func NewParserSize(r io.Reader, maxLineSize int) *Parser {
+	return &Parser{
+		r: bufio.NewReaderSize(r, maxLineSize),
+	}
+}
+
+// readLine returns the next line without its line ending, or nil if it is
+// longer than the buffer. The line is only valid until the next read.
+func (p *Parser) readLine() ([]byte, error) {
+	line, err := p.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// drop the rest of the line
+		for err == bufio.ErrBufferFull {
+			_, err = p.r.ReadSlice('\n')
+		}
+		p.Lines++
+		p.Oversized++
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return nil, nil
+	}
+	if len(line) == 0 && err != nil {
+		return nil, err
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	p.Lines++
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// Next returns the next event of the log, or io.EOF at its end. Lines
+// without events are skipped.
+func (p *Parser) Next() (Event, error) {
+	for {
+		line, err := p.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if event := parseLine(line); event != nil {
+			return event, nil
+		}
+	}
+}
+
+// parseLine returns the event of a text or JSON line, or nil if the line
+// has none.
+func parseLine(line []byte) Event {
+	trimmed := bytes.TrimLeft(line, " \t")
+	if len(trimmed) == 0 {
+		return nil
+	}
+	if trimmed[0] == '{' {
+		return parseJSONLine(trimmed)
+	}
+	return parseTextLine(string(trimmed))
+}
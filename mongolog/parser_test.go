@@ -0,0 +1,279 @@
+package mongolog
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustTime(t *testing.T, s string) time.Time {
+	parsed, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestParseTextLine(t *testing.T) {
+	at := mustTime(t, "2017-01-02T10:00:00.123+08:00")
+	tests := []struct {
+		name string
+		line string
+		want Event
+	}{
+		{
+			name: "command with a key pattern",
+			line: `2017-01-02T10:00:00.123+0800 I COMMAND  [conn12] command test.users command: find { find: "users", filter: { a: 5, b: 6 } } planSummary: IXSCAN { a: 1, b: -1 } keysExamined:10 docsExamined:10 cursorExhausted:1 numYields:0 nreturned:10 reslen:1234 locks:{} protocol:op_command 150ms`,
+			want: &SlowOp{
+				Time: at, Context: "conn12", Op: "command", Command: "find", Ns: "test.users",
+				DurationMillis: 150, PlanSummary: "IXSCAN { a: 1, b: -1 }",
+				KeysExamined: 10, DocsExamined: 10, NReturned: 10,
+			},
+		},
+		{
+			name: "nscanned is keysExamined",
+			line: `2017-01-02T10:00:00.123+0800 I QUERY    [conn5] query test.c query: { a: 1 } planSummary: COLLSCAN ntoreturn:0 ntoskip:0 nscanned:0 nscannedObjects:300 keyUpdates:0 numYields:2 nreturned:3 reslen:100 locks:{} 200ms`,
+			want: &SlowOp{
+				Time: at, Context: "conn5", Op: "query", Ns: "test.c",
+				DurationMillis: 200, PlanSummary: "COLLSCAN",
+				KeysExamined: 0, DocsExamined: 300, NReturned: 3,
+			},
+		},
+		{
+			name: "update without a plan summary",
+			line: `2017-01-02T10:00:00.123+0800 I WRITE    [conn12] update test.users query: { _id: 7 } update: { $set: { b: 1 } } keysExamined:1 docsExamined:1 nMatched:1 nModified:1 numYields:0 locks:{} 120ms`,
+			want: &SlowOp{
+				Time: at, Context: "conn12", Op: "update", Ns: "test.users",
+				DurationMillis: 120, KeysExamined: 1, DocsExamined: 1,
+			},
+		},
+		{
+			name: "connection accepted",
+			line: `2017-01-02T10:00:00.123+0800 I NETWORK  [initandlisten] connection accepted from 10.0.0.5:51234 #12 (1 connection now open)`,
+			want: &ConnEvent{Time: at, Accepted: true, Remote: "10.0.0.5:51234", ConnId: 12, Open: 1},
+		},
+		{
+			name: "connection ended",
+			line: `2017-01-02T10:00:00.123+0800 I NETWORK  [conn12] end connection 10.0.0.5:51234 (3 connections now open)`,
+			want: &ConnEvent{Time: at, Remote: "10.0.0.5:51234", ConnId: 12, Open: 3},
+		},
+		{
+			name: "state transition",
+			line: `2017-01-02T10:00:00.123+0800 I REPL     [ReplicationExecutor] transition to PRIMARY`,
+			want: &StateChange{Time: at, To: "PRIMARY"},
+		},
+		{
+			name: "state transition from a state",
+			line: `2017-01-02T10:00:00.123+0800 I REPL     [rsSync] transition to SECONDARY from RECOVERING`,
+			want: &StateChange{Time: at, From: "RECOVERING", To: "SECONDARY"},
+		},
+		{
+			name: "utc timestamp",
+			line: `2017-01-02T02:00:00.123Z I REPL     [ReplicationExecutor] transition to PRIMARY`,
+			want: &StateChange{Time: mustTime(t, "2017-01-02T02:00:00.123Z"), To: "PRIMARY"},
+		},
+		{
+			name: "line without an event",
+			line: `2017-01-02T10:00:00.123+0800 I CONTROL  [initandlisten] db version v3.2.22`,
+		},
+		{
+			name: "not a log line",
+			line: `connection accepted from 10.0.0.5:51234 #12 (1 connection now open)`,
+		},
+	}
+
+	for _, test := range tests {
+		got := parseTextLine(test.line)
+		if test.want == nil {
+			if got != nil {
+				t.Errorf("%v: got %+v, want no event", test.name, got)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) || !got.EventTime().Equal(test.want.EventTime()) {
+			t.Errorf("%v: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseJSONLine(t *testing.T) {
+	at := mustTime(t, "2020-11-04T10:00:00.123+08:00")
+	tests := []struct {
+		name string
+		line string
+		want Event
+	}{
+		{
+			name: "slow command with a key pattern",
+			line: `{"t":{"$date":"2020-11-04T10:00:00.123+08:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn21","msg":"Slow query","attr":{"type":"command","ns":"test.users","command":{"find":"users","filter":{"a":5},"$db":"test"},"planSummary":"IXSCAN { a: 1 }","keysExamined":10,"docsExamined":10,"nreturned":10,"durationMillis":150}}`,
+			want: &SlowOp{
+				Time: at, Context: "conn21", Op: "command", Command: "find", Ns: "test.users",
+				DurationMillis: 150, PlanSummary: "IXSCAN { a: 1 }",
+				KeysExamined: 10, DocsExamined: 10, NReturned: 10,
+			},
+		},
+		{
+			name: "slow update",
+			line: `{"t":{"$date":"2020-11-04T10:00:00.123+08:00"},"s":"I","c":"WRITE","id":51803,"ctx":"conn21","msg":"Slow query","attr":{"type":"update","ns":"test.users","command":{"q":{"_id":7},"u":{"$set":{"b":1}}},"planSummary":"IDHACK","keysExamined":1,"docsExamined":1,"durationMillis":120}}`,
+			want: &SlowOp{
+				Time: at, Context: "conn21", Op: "update", Ns: "test.users",
+				DurationMillis: 120, PlanSummary: "IDHACK", KeysExamined: 1, DocsExamined: 1,
+			},
+		},
+		{
+			name: "connection accepted",
+			line: `{"t":{"$date":"2020-11-04T10:00:00.123+08:00"},"s":"I","c":"NETWORK","id":22943,"ctx":"listener","msg":"Connection accepted","attr":{"remote":"10.0.0.7:50000","connectionId":21,"connectionCount":4}}`,
+			want: &ConnEvent{Time: at, Accepted: true, Remote: "10.0.0.7:50000", ConnId: 21, Open: 4},
+		},
+		{
+			name: "connection ended",
+			line: `{"t":{"$date":"2020-11-04T10:00:00.123+08:00"},"s":"I","c":"NETWORK","id":22944,"ctx":"conn21","msg":"Connection ended","attr":{"remote":"10.0.0.7:50000","connectionId":21,"connectionCount":3}}`,
+			want: &ConnEvent{Time: at, Remote: "10.0.0.7:50000", ConnId: 21, Open: 3},
+		},
+		{
+			name: "state transition",
+			line: `{"t":{"$date":"2020-11-04T10:00:00.123+08:00"},"s":"I","c":"REPL","id":21358,"ctx":"ReplCoord-0","msg":"Replica set state transition","attr":{"newState":"PRIMARY","oldState":"SECONDARY"}}`,
+			want: &StateChange{Time: at, From: "SECONDARY", To: "PRIMARY"},
+		},
+		{
+			name: "message only mentioned in an attribute",
+			line: `{"t":{"$date":"2020-11-04T10:00:00.123+08:00"},"s":"I","c":"CONTROL","id":1,"ctx":"main","msg":"Other","attr":{"note":"Slow query"}}`,
+		},
+		{
+			name: "truncated line",
+			line: `{"t":{"$date":"2020-11-04T10:00:00.123+08:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn21","msg":"Slow query","attr":{"type":"comm`,
+		},
+	}
+
+	for _, test := range tests {
+		got := parseJSONLine([]byte(test.line))
+		if test.want == nil {
+			if got != nil {
+				t.Errorf("%v: got %+v, want no event", test.name, got)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) || !got.EventTime().Equal(test.want.EventTime()) {
+			t.Errorf("%v: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+// readEvents returns every event of the parser.
+func readEvents(t *testing.T, p *Parser) []Event {
+	events := []Event{}
+	for {
+		event, err := p.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+}
+
+// eventKinds describes the events by type and a few fields, to compare
+// whole fixtures at a glance.
+func eventKinds(events []Event) []string {
+	kinds := []string{}
+	for _, event := range events {
+		switch e := event.(type) {
+		case *SlowOp:
+			kinds = append(kinds, "slow "+e.Name()+" "+e.Ns+" "+e.PlanSummary)
+		case *ConnEvent:
+			if e.Accepted {
+				kinds = append(kinds, "accepted "+e.Remote)
+			} else {
+				kinds = append(kinds, "ended "+e.Remote)
+			}
+		case *StateChange:
+			kinds = append(kinds, "state "+e.From+">"+e.To)
+		}
+	}
+	return kinds
+}
+
+func TestParseFixtures(t *testing.T) {
+	tests := []struct {
+		file  string
+		lines int64
+		want  []string
+	}{
+		{
+			file:  "testdata/mongod-3.2.log",
+			lines: 8,
+			want: []string{
+				"state >STARTUP2",
+				"state >RECOVERING",
+				"state >SECONDARY",
+				"accepted 10.0.0.5:51234",
+				"slow find test.users IXSCAN { a: 1 }",
+				"slow update test.users ",
+				"ended 10.0.0.5:51234",
+			},
+		},
+		{
+			file:  "testdata/mongod-3.4.log",
+			lines: 7,
+			want: []string{
+				"state RECOVERING>SECONDARY",
+				"state SECONDARY>PRIMARY",
+				"accepted 10.0.0.6:40000",
+				"slow aggregate shop.orders COLLSCAN",
+				"slow query shop.orders IXSCAN { status: 1, created: -1 }",
+				"ended 10.0.0.6:40000",
+			},
+		},
+		{
+			file:  "testdata/mongod-4.4.log",
+			lines: 6,
+			want: []string{
+				"state RECOVERING>SECONDARY",
+				"accepted 10.0.0.7:50000",
+				"slow find test.users IXSCAN { a: 1 }",
+				"slow update test.users IDHACK",
+				"ended 10.0.0.7:50000",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		f, err := os.Open(test.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := NewParser(f)
+		got := eventKinds(readEvents(t, p))
+		f.Close()
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got events\n%v\nwant\n%v", test.file, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+		if p.Lines != test.lines || p.Oversized != 0 {
+			t.Errorf("%v: read %v lines, %v oversized", test.file, p.Lines, p.Oversized)
+		}
+	}
+}
+
+func TestParserSkipsOversizedLines(t *testing.T) {
+	short := `2017-01-02T10:00:00.123+0800 I REPL     [ReplicationExecutor] transition to PRIMARY`
+	long := `2017-01-02T10:00:01.000+0800 I COMMAND  [conn12] command test.users command: find { filter: { a: "` +
+		strings.Repeat("x", 1000) + `" } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 nreturned:1 150ms`
+	log := short + "\n" + long + "\n" + short + "\n"
+
+	p := NewParserSize(strings.NewReader(log), 256)
+	got := eventKinds(readEvents(t, p))
+
+	want := []string{"state >PRIMARY", "state >PRIMARY"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %v, want %v", got, want)
+	}
+	if p.Lines != 3 || p.Oversized != 1 {
+		t.Errorf("read %v lines, %v oversized", p.Lines, p.Oversized)
+	}
+}
@@ -0,0 +1,224 @@
+package mongolog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xkeyideal/mongo-tools/common/text"
+)
+
+// SlowOpGroup aggregates the slow operations of one namespace, operation
+// and plan.
+type SlowOpGroup struct {
+	Ns          string `json:"ns"`
+	Op          string `json:"op"`
+	PlanSummary string `json:"planSummary,omitempty"`
+
+	Count        int64 `json:"count"`
+	TotalMillis  int64 `json:"totalMillis"`
+	MaxMillis    int64 `json:"maxMillis"`
+	KeysExamined int64 `json:"keysExamined"`
+	DocsExamined int64 `json:"docsExamined"`
+	NReturned    int64 `json:"nreturned"`
+}
+
+// AvgMillis is the average duration of the operations
+func (g *SlowOpGroup) AvgMillis() float64 {
+	if g.Count == 0 {
+		return 0
+	}
+	return float64(g.TotalMillis) / float64(g.Count)
+}
+
+// HostConns counts the connections of one client host
+type HostConns struct {
+	Host     string `json:"host"`
+	Accepted int64  `json:"accepted"`
+	Ended    int64  `json:"ended"`
+}
+
+// Summary aggregates the events of a log. It keeps one entry per slow
+// operation group and per client host, so its size depends on the variety
+// of the log rather than its length. State changes are kept in full, as
+// they are rare.
+type Summary struct {
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+
+	Lines     int64 `json:"lines"`
+	Oversized int64 `json:"oversized,omitempty"`
+
+	SlowOps []*SlowOpGroup `json:"slowOps"`
+
+	ConnsAccepted int64        `json:"connsAccepted"`
+	ConnsEnded    int64        `json:"connsEnded"`
+	PeakOpen      int64        `json:"peakOpen"`
+	Hosts         []*HostConns `json:"hosts"`
+
+	StateChanges []*StateChange `json:"stateChanges"`
+
+	slowOps map[SlowOpGroup]*SlowOpGroup
+	hosts   map[string]*HostConns
+}
+
+func NewSummary() *Summary {
+	return &Summary{
+		SlowOps:      []*SlowOpGroup{},
+		Hosts:        []*HostConns{},
+		StateChanges: []*StateChange{},
+		slowOps:      map[SlowOpGroup]*SlowOpGroup{},
+		hosts:        map[string]*HostConns{},
+	}
+}
+
+// Analyze streams the log and summarizes its events
+func Analyze(r io.Reader) (*Summary, error) {
+	parser := NewParser(r)
+	summary := NewSummary()
+	for {
+		event, err := parser.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		summary.Add(event)
+	}
+	summary.Lines = parser.Lines
+	summary.Oversized = parser.Oversized
+	summary.Sort()
+	return summary, nil
+}
+
+// Add adds an event to the summary
+func (s *Summary) Add(event Event) {
+	t := event.EventTime()
+	if s.First.IsZero() || t.Before(s.First) {
+		s.First = t
+	}
+	if t.After(s.Last) {
+		s.Last = t
+	}
+
+	switch e := event.(type) {
+	case *SlowOp:
+		key := SlowOpGroup{Ns: e.Ns, Op: e.Name(), PlanSummary: e.PlanSummary}
+		group, ok := s.slowOps[key]
+		if !ok {
+			group = &SlowOpGroup{Ns: key.Ns, Op: key.Op, PlanSummary: key.PlanSummary}
+			s.slowOps[key] = group
+			s.SlowOps = append(s.SlowOps, group)
+		}
+		group.Count++
+		group.TotalMillis += e.DurationMillis
+		if e.DurationMillis > group.MaxMillis {
+			group.MaxMillis = e.DurationMillis
+		}
+		group.KeysExamined += e.KeysExamined
+		group.DocsExamined += e.DocsExamined
+		group.NReturned += e.NReturned
+	case *ConnEvent:
+		host := e.Remote
+		if h, _, err := net.SplitHostPort(e.Remote); err == nil {
+			host = h
+		}
+		conns, ok := s.hosts[host]
+		if !ok {
+			conns = &HostConns{Host: host}
+			s.hosts[host] = conns
+			s.Hosts = append(s.Hosts, conns)
+		}
+		if e.Accepted {
+			s.ConnsAccepted++
+			conns.Accepted++
+		} else {
+			s.ConnsEnded++
+			conns.Ended++
+		}
+		if e.Open > s.PeakOpen {
+			s.PeakOpen = e.Open
+		}
+	case *StateChange:
+		s.StateChanges = append(s.StateChanges, e)
+	}
+}
+
+// Sort orders the slow operations by total duration, the hosts by accepted
+// connections and the state changes by time.
+func (s *Summary) Sort() {
+	sort.SliceStable(s.SlowOps, func(i, j int) bool {
+		return s.SlowOps[i].TotalMillis > s.SlowOps[j].TotalMillis
+	})
+	sort.SliceStable(s.Hosts, func(i, j int) bool {
+		return s.Hosts[i].Accepted > s.Hosts[j].Accepted
+	})
+	sort.SliceStable(s.StateChanges, func(i, j int) bool {
+		return s.StateChanges[i].Time.Before(s.StateChanges[j].Time)
+	})
+}
+
+// Grid returns the summary as tables of slow operations, connections per
+// host and state changes.
+func (s *Summary) Grid() string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%v lines from %v to %v\n\n", s.Lines,
+		s.First.Format(time.RFC3339), s.Last.Format(time.RFC3339))
+
+	out := &text.GridWriter{ColumnPadding: 2}
+	out.WriteCells("ns", "op", "plan", "count", "total", "avg", "max", "keys", "docs", "returned")
+	out.EndRow()
+	for _, g := range s.SlowOps {
+		out.WriteCells(g.Ns, g.Op, g.PlanSummary,
+			fmt.Sprintf("%v", g.Count),
+			fmt.Sprintf("%vms", g.TotalMillis),
+			fmt.Sprintf("%.0fms", g.AvgMillis()),
+			fmt.Sprintf("%vms", g.MaxMillis),
+			fmt.Sprintf("%v", g.KeysExamined),
+			fmt.Sprintf("%v", g.DocsExamined),
+			fmt.Sprintf("%v", g.NReturned))
+		out.EndRow()
+	}
+	out.Flush(buf)
+
+	fmt.Fprintf(buf, "\nconnections: %v accepted, %v ended, %v peak open\n",
+		s.ConnsAccepted, s.ConnsEnded, s.PeakOpen)
+	out = &text.GridWriter{ColumnPadding: 2}
+	out.WriteCells("host", "accepted", "ended")
+	out.EndRow()
+	for _, h := range s.Hosts {
+		out.WriteCells(h.Host, fmt.Sprintf("%v", h.Accepted), fmt.Sprintf("%v", h.Ended))
+		out.EndRow()
+	}
+	out.Flush(buf)
+
+	if len(s.StateChanges) > 0 {
+		buf.WriteString("\nstate changes:\n")
+		for _, sc := range s.StateChanges {
+			from := sc.From
+			if from == "" {
+				from = "?"
+			}
+			fmt.Fprintf(buf, "%v  %v -> %v\n", sc.Time.Format(time.RFC3339Nano), from, sc.To)
+		}
+	}
+	if s.Oversized > 0 {
+		fmt.Fprintf(buf, "\nwarning: skipped %v oversized lines\n", s.Oversized)
+	}
+	return strings.TrimRight(buf.String(), "\n") + "\n"
+}
+
+// JSON returns the summary as JSON
+func (s *Summary) JSON() string {
+	bytes, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Sprintf(`{"json error": %q}`, err.Error())
+	}
+	return string(bytes)
+}
@@ -0,0 +1,115 @@
+package mongolog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// textLayouts are the iso8601-local and iso8601-utc timestamp formats of
+// the text logs
+var textLayouts = []string{
+	"2006-01-02T15:04:05.000-0700",
+	"2006-01-02T15:04:05.000Z07:00",
+}
+
+var (
+	// 2017-01-02T10:00:00.123+0800 I COMMAND  [conn12] <message>
+	textLineRegex = regexp.MustCompile(`^(\S+)\s+[FEWID]\d?\s+\S+\s+\[([^\]]+)\]\s(.*)$`)
+
+	slowOpRegex      = regexp.MustCompile(`^(query|getmore|command|update|remove|insert|killcursors) (\S+)(?: (.*))? (\d+)ms$`)
+	commandNameRegex = regexp.MustCompile(`(?:^| )command: (\w+)`)
+
+	// the plan summary may contain a key pattern, e.g. IXSCAN { a: 1 }, and
+	// is followed by a counter, e.g. keysExamined:0
+	planSummaryRegex = regexp.MustCompile(`planSummary: (.+?) \w+:\S`)
+	counterRegex     = regexp.MustCompile(`\b(keysExamined|docsExamined|nscanned|nscannedObjects|nreturned):(\d+)`)
+
+	connAcceptedRegex = regexp.MustCompile(`^connection accepted from (\S+) #(\d+) \((\d+) connections? now open\)`)
+	connEndedRegex    = regexp.MustCompile(`^end connection (\S+) \((\d+) connections? now open\)`)
+	transitionRegex   = regexp.MustCompile(`^transition to (\w+)(?: from (\w+))?`)
+)
+
+func parseTextTime(s string) (time.Time, bool) {
+	for _, layout := range textLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// connId returns the connection id of a conn<id> context
+func connId(context string) int64 {
+	if !strings.HasPrefix(context, "conn") {
+		return 0
+	}
+	id, _ := strconv.ParseInt(context[len("conn"):], 10, 64)
+	return id
+}
+
+// parseTextLine returns the event of a text log line, or nil if the line
+// has none.
+func parseTextLine(line string) Event {
+	match := textLineRegex.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	t, ok := parseTextTime(match[1])
+	if !ok {
+		return nil
+	}
+	context, msg := match[2], match[3]
+
+	if m := slowOpRegex.FindStringSubmatch(msg); m != nil {
+		return parseTextSlowOp(t, context, m)
+	}
+	if m := connAcceptedRegex.FindStringSubmatch(msg); m != nil {
+		id, _ := strconv.ParseInt(m[2], 10, 64)
+		open, _ := strconv.ParseInt(m[3], 10, 64)
+		return &ConnEvent{Time: t, Accepted: true, Remote: m[1], ConnId: id, Open: open}
+	}
+	if m := connEndedRegex.FindStringSubmatch(msg); m != nil {
+		open, _ := strconv.ParseInt(m[2], 10, 64)
+		return &ConnEvent{Time: t, Remote: m[1], ConnId: connId(context), Open: open}
+	}
+	if m := transitionRegex.FindStringSubmatch(msg); m != nil {
+		return &StateChange{Time: t, From: m[2], To: m[1]}
+	}
+	return nil
+}
+
+func parseTextSlowOp(t time.Time, context string, m []string) *SlowOp {
+	op := &SlowOp{
+		Time:    t,
+		Context: context,
+		Op:      m[1],
+		Ns:      m[2],
+	}
+	op.DurationMillis, _ = strconv.ParseInt(m[4], 10, 64)
+
+	details := m[3]
+	if op.Op == "command" {
+		if c := commandNameRegex.FindStringSubmatch(details); c != nil {
+			op.Command = c[1]
+		}
+	}
+	if p := planSummaryRegex.FindStringSubmatch(details); p != nil {
+		op.PlanSummary = p[1]
+	}
+
+	// 3.2 renamed nscanned and nscannedObjects, keep the newer names
+	for _, c := range counterRegex.FindAllStringSubmatch(details, -1) {
+		n, _ := strconv.ParseInt(c[2], 10, 64)
+		switch c[1] {
+		case "keysExamined", "nscanned":
+			op.KeysExamined = n
+		case "docsExamined", "nscannedObjects":
+			op.DocsExamined = n
+		case "nreturned":
+			op.NReturned = n
+		}
+	}
+	return op
+}
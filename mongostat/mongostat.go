@@ -3,6 +3,8 @@ package mongostat
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -16,9 +18,14 @@ import (
 
 	"github.com/xkeyideal/mongo-tools/mongostat/status"
 
+	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
+// ChannelClosed and ChannelUnclosed are the values of StorageClosed.
+//
+// Deprecated: Storage is closed once its producer is done, so ranging over it
+// or the second result of Message tells when the output ended.
 const (
 	ChannelClosed   int32 = 1
 	ChannelUnclosed int32 = 0
@@ -47,9 +54,15 @@ type MongoStat struct {
 	// ClusterMonitor to manage collecting and printing the stats from all nodes.
 	Cluster ClusterMonitor
 
+	// Fan-out of the cluster's output to subscribers, nil for a sample stream.
+	subscriptions *Subscriptions
+
 	// Mutex to handle safe concurrent adding to or looping over discovered nodes.
 	nodesLock sync.RWMutex
 
+	// Tracks the node goroutines, their polls and Run, for Wait.
+	group sync.WaitGroup
+
 	ctx    context.Context
 	cancel context.CancelFunc
 }
@@ -63,31 +76,16 @@ func NewMongoStat(ctx context.Context, opts *options.ToolOptions,
 		RowCount:      rowCount,
 	}
 
-	var factory stat_consumer.FormatterConstructor
-	if statOpts.Json {
-		factory = stat_consumer.FormatterConstructors["json"]
-	} else {
-		factory = stat_consumer.FormatterConstructors["grid"]
-	}
-	formatter := factory(statOpts.RowCount, !statOpts.NoHeaders)
-
-	cliFlags := line.FlagHosts | line.FlagAlways
-
-	if statOpts.All {
-		cliFlags |= line.FlagAll
-	}
-
-	keyNames := line.DeprecatedKeyMap()
+	return NewMongoStatWithOptions(ctx, opts, statOpts, sleep, during)
+}
 
-	readerConfig := &status.ReaderConfig{
-		HumanReadable: statOpts.HumanReadable,
-		TimeFormat:    "2006-01-02 15:04:05",
-	}
-	if statOpts.Json {
-		readerConfig.TimeFormat = "15:04:05"
-	}
+// NewMongoStatWithOptions is like NewMongoStat, but lets the caller choose
+// the output options, e.g. to enable the optional column groups.
+func NewMongoStatWithOptions(ctx context.Context, opts *options.ToolOptions,
+	statOpts *StatOptions, sleep time.Duration, during int64) (*MongoStat, error) {
 
-	consumer := stat_consumer.NewStatConsumer(cliFlags, []string{}, keyNames, readerConfig, formatter)
+	consumer := newStatConsumer(statOpts)
+	subscriptions := newSubscriptions()
 
 	statctx, statcancel := context.WithCancel(ctx)
 
@@ -97,9 +95,11 @@ func NewMongoStat(ctx context.Context, opts *options.ToolOptions,
 			ReportChan:    make(chan *status.ServerStatus, len(opts.Addrs)),
 			ErrorChan:     make(chan *status.NodeError, len(opts.Addrs)),
 			LastStatLines: map[string]*line.StatLine{},
+			lastDataLines: map[string]*line.StatLine{},
 			Storage:       make(chan string, 10),
-			StorageClosed: 0,
+			Subscriptions: subscriptions,
 			Consumer:      consumer,
+			Totals:        statOpts.Totals,
 			startTime:     time.Now().Unix(),
 			during:        during,
 			ctx:           statctx,
@@ -109,7 +109,7 @@ func NewMongoStat(ctx context.Context, opts *options.ToolOptions,
 			ReportChan:    make(chan *status.ServerStatus),
 			ErrorChan:     make(chan *status.NodeError),
 			Storage:       make(chan string, 10),
-			StorageClosed: 0,
+			Subscriptions: subscriptions,
 			Consumer:      consumer,
 			startTime:     time.Now().Unix(),
 			during:        during,
@@ -117,14 +117,86 @@ func NewMongoStat(ctx context.Context, opts *options.ToolOptions,
 		}
 	}
 
+	return newMongoStat(statctx, statcancel, opts, statOpts, sleep, cluster, subscriptions)
+}
+
+// NewMongoStatSamples creates a MongoStat for programmatic use. Instead of
+// rendered text, every poll of every host is delivered as a typed Sample on
+// the channel returned by Samples. Run must be called to start the stream,
+// which is closed once ctx is done or Stop is called.
+func NewMongoStatSamples(ctx context.Context, opts *options.ToolOptions,
+	statOpts *StatOptions, sleep time.Duration) (*MongoStat, error) {
+
+	statctx, statcancel := context.WithCancel(ctx)
+
+	cluster := &SampleClusterMonitor{
+		ReportChan: make(chan *status.ServerStatus, len(opts.Addrs)),
+		ErrorChan:  make(chan *status.NodeError, len(opts.Addrs)),
+		Samples:    make(chan stat_consumer.Sample, len(opts.Addrs)),
+		Consumer:   newStatConsumer(statOpts),
+		ctx:        statctx,
+	}
+
+	return newMongoStat(statctx, statcancel, opts, statOpts, sleep, cluster, nil)
+}
+
+// newStatConsumer creates the StatConsumer for the given output options.
+func newStatConsumer(statOpts *StatOptions) *stat_consumer.StatConsumer {
+	var factory stat_consumer.FormatterConstructor
+	if statOpts.Json {
+		factory = stat_consumer.FormatterConstructors["json"]
+	} else {
+		factory = stat_consumer.FormatterConstructors["grid"]
+	}
+	formatter := factory(statOpts.RowCount, !statOpts.NoHeaders)
+
+	cliFlags := line.FlagHosts | line.FlagAlways
+
+	if statOpts.All {
+		cliFlags |= line.FlagAll
+	}
+	if statOpts.WTExtended {
+		cliFlags |= line.FlagWTExtended
+	}
+	if statOpts.ReplLag {
+		cliFlags |= line.FlagReplLag
+	}
+	if statOpts.Metrics {
+		cliFlags |= line.FlagMetrics
+	}
+	if statOpts.Clock {
+		cliFlags |= line.FlagClock
+	}
+
+	keyNames := line.DeprecatedKeyMap()
+
+	readerConfig := &status.ReaderConfig{
+		HumanReadable: statOpts.HumanReadable,
+		TimeFormat:    "2006-01-02 15:04:05",
+		SkewThreshold: time.Duration(statOpts.SkewThreshold) * time.Millisecond,
+	}
+	if statOpts.Json {
+		readerConfig.TimeFormat = "15:04:05"
+	}
+
+	return stat_consumer.NewStatConsumer(cliFlags, []string{}, keyNames, readerConfig, formatter)
+}
+
+// newMongoStat creates the MongoStat for the given cluster monitor and starts
+// watching all the hosts in opts.
+func newMongoStat(ctx context.Context, cancel context.CancelFunc, opts *options.ToolOptions,
+	statOpts *StatOptions, sleep time.Duration, cluster ClusterMonitor,
+	subscriptions *Subscriptions) (*MongoStat, error) {
+
 	stat := &MongoStat{
 		Options:       opts,
 		StatOptions:   statOpts,
 		Nodes:         map[string]*NodeMonitor{},
 		SleepInterval: sleep,
 		Cluster:       cluster,
-		ctx:           statctx,
-		cancel:        statcancel,
+		subscriptions: subscriptions,
+		ctx:           ctx,
+		cancel:        cancel,
 	}
 
 	for _, v := range opts.Addrs {
@@ -145,18 +217,69 @@ type ConfigShard struct {
 	Host string `bson:"host"`
 }
 
+// DefaultPollTimeout is how long a poll may take at least before the host is
+// reported as timed out, when no PollTimeout is given. It is raised to twice
+// the polling interval for longer intervals.
+const DefaultPollTimeout = 5 * time.Second
+
+// pollTimeout returns the poll deadline for the options and polling interval.
+func pollTimeout(statOpts *StatOptions, sleep time.Duration) time.Duration {
+	if statOpts.PollTimeout > 0 {
+		return time.Duration(statOpts.PollTimeout) * time.Second
+	}
+	if 2*sleep > DefaultPollTimeout {
+		return 2 * sleep
+	}
+	return DefaultPollTimeout
+}
+
+// A Poller collects the serverStatus of a single host. A NodeMonitor polls
+// its host through one, which can be replaced, e.g. by a fake host in tests.
+type Poller interface {
+	Poll() (*status.ServerStatus, error)
+}
+
+// sessionPoller is the Poller of a host reached through a SessionProvider.
+type sessionPoller struct {
+	sessionProvider *db.SessionProvider
+
+	// Whether to also poll replSetGetStatus for the replication lag column.
+	pollLag bool
+
+	// Whether to request the metrics section of serverStatus, which is
+	// large, for the metrics columns.
+	pollMetrics bool
+
+	// The socket timeout, the poll deadline of the node.
+	timeout time.Duration
+}
+
 // NodeMonitor contains the connection pool for a single host and collects the
 // mongostat data for that host on a regular interval.
 type NodeMonitor struct {
 	host, alias     string
 	sessionProvider *db.SessionProvider
 
+	// Polls the host, by default through sessionProvider.
+	poller Poller
+
 	// The time at which the node monitor last processed an update successfully.
 	LastUpdate time.Time
 
 	// The most recent error encountered when collecting stats for this node.
 	Err error
 
+	// How long a poll may take before the node is reported as timed out.
+	timeout time.Duration
+
+	// Set while a poll is in flight, so that a hung host is not polled again.
+	// Accessed atomically.
+	polling int32
+
+	// The MongoStat's run group, which also tracks polls left running
+	// after their deadline.
+	group *sync.WaitGroup
+
 	ctx context.Context
 }
 
@@ -170,9 +293,18 @@ type SyncClusterMonitor struct {
 	// Channel to listen for incoming errors
 	ErrorChan chan *status.NodeError
 
-	Storage       chan string
+	// Formatted output, closed once Monitor returns
+	Storage   chan string
+	closeOnce sync.Once
+
+	// StorageClosed is set to ChannelClosed, atomically, once Storage is
+	// closed.
+	//
+	// Deprecated: maintained for compatibility, see ChannelClosed.
 	StorageClosed int32
-	lock          sync.Mutex
+
+	// Subscribers receiving the output alongside Storage
+	Subscriptions *Subscriptions
 
 	// Creates and consumes StatLines using ServerStatuses
 	Consumer *stat_consumer.StatConsumer
@@ -217,12 +349,30 @@ type AsyncClusterMonitor struct {
 	// Map of hostname -> latest stat data for the host
 	LastStatLines map[string]*line.StatLine
 
-	Storage       chan string
+	// Map of hostname -> latest successful sample of the host, for the
+	// TOTAL lines. A host is removed when its poll fails, and kept while it
+	// merely has no fresh sample for a snapshot.
+	lastDataLines map[string]*line.StatLine
+
+	// Formatted output, closed once Monitor returns
+	Storage   chan string
+	closeOnce sync.Once
+
+	// StorageClosed is set to ChannelClosed, atomically, once Storage is
+	// closed.
+	//
+	// Deprecated: maintained for compatibility, see ChannelClosed.
 	StorageClosed int32
 
+	// Subscribers receiving the output alongside Storage
+	Subscriptions *Subscriptions
+
 	// Mutex to protect access to LastStatLines
 	mapLock sync.RWMutex
 
+	// Whether to add the aggregate TOTAL lines to each snapshot
+	Totals bool
+
 	// Creates and consumes StatLines using ServerStatuses
 	Consumer *stat_consumer.StatConsumer
 
@@ -244,17 +394,14 @@ func (cluster *SyncClusterMonitor) Reset() {
 	cluster.Consumer.Reset()
 }
 
+// onceDone closes the output. Only Monitor publishes to it, so it must be
+// called once Monitor has returned, or by Monitor itself on the way out.
+// Output already queued stays readable until it is drained.
 func (cluster *SyncClusterMonitor) onceDone() {
-	if atomic.LoadInt32(&cluster.StorageClosed) == ChannelClosed {
-		return
-	}
-
-	cluster.lock.Lock()
-	if cluster.StorageClosed == ChannelUnclosed {
-		close(cluster.Storage)
-		atomic.StoreInt32(&cluster.StorageClosed, ChannelClosed)
-	}
-	cluster.lock.Unlock()
+	cluster.closeOnce.Do(func() {
+		cluster.Subscriptions.closeStorage(cluster.Storage, &cluster.StorageClosed)
+		cluster.Subscriptions.closeAll()
+	})
 }
 
 // Update refreshes the internal state of the cluster monitor with the data
@@ -263,53 +410,52 @@ func (cluster *SyncClusterMonitor) onceDone() {
 // once for each poll.
 func (cluster *SyncClusterMonitor) Update(stat *status.ServerStatus, err *status.NodeError) {
 	if err != nil {
-		cluster.ErrorChan <- err
+		select {
+		case cluster.ErrorChan <- err:
+		case <-cluster.ctx.Done():
+		}
 		return
 	}
-	cluster.ReportChan <- stat
+	select {
+	case cluster.ReportChan <- stat:
+	case <-cluster.ctx.Done():
+	}
 }
 
 // Monitor waits for data on the cluster's report channel. Once new data comes
 // in, it formats and then displays it to stdout.
 func (cluster *SyncClusterMonitor) Monitor(_ time.Duration) error {
+	defer cluster.onceDone()
+
 	receivedData := false
 	for {
 		var statLine *line.StatLine
-		var ok bool
 		select {
 		case stat := <-cluster.ReportChan:
-			statLine, ok = cluster.Consumer.Update(stat)
-			if !ok {
+			var restart *status.NodeError
+			statLine, restart = cluster.Consumer.UpdateWithRestart(stat)
+			if restart != nil {
+				// a restart is reported like an error, but the host answered
+				statLine = line.NewErrorStatLine(restart)
+			} else if statLine == nil {
 				continue
 			}
 		case err := <-cluster.ErrorChan:
-			if !receivedData {
-				statLine = &line.StatLine{
-					Error:  err,
-					Fields: map[string]string{"host": err.Host},
-				}
-				str, _ := cluster.Consumer.FormatLines([]*line.StatLine{statLine})
-				cluster.Storage <- str
-				//sleep 100ms 让channel有时间反应，将错误数据发送出去
-				time.Sleep(100 * time.Millisecond)
-				cluster.onceDone()
+			statLine = line.NewErrorStatLine(err)
+			// a host slow to answer at first, e.g. while connecting, is
+			// reported but may still catch up
+			if !receivedData && !err.TimedOut() {
+				cluster.Subscriptions.publish(cluster.ctx.Done(), cluster.Consumer, cluster.Storage, &cluster.StorageClosed, []*line.StatLine{statLine})
 				return err
 			}
-			statLine = &line.StatLine{
-				Error:  err,
-				Fields: map[string]string{"host": err.Host},
-			}
 		case <-cluster.ctx.Done():
-			cluster.onceDone()
 			//fmt.Println("sync cluster monitor ctx done")
 			return nil
 		}
 		receivedData = true
-		str, finish := cluster.Consumer.FormatLines([]*line.StatLine{statLine})
-		cluster.Storage <- str
+		finish := cluster.Subscriptions.publish(cluster.ctx.Done(), cluster.Consumer, cluster.Storage, &cluster.StorageClosed, []*line.StatLine{statLine})
 		timeout := time.Now().Unix()-cluster.startTime > cluster.during
 		if finish || timeout {
-			cluster.onceDone()
 			return nil
 		}
 	}
@@ -325,17 +471,14 @@ func (cluster *AsyncClusterMonitor) Reset() {
 	cluster.Consumer.Reset()
 }
 
+// onceDone closes the output. Only Monitor publishes to it, so it must be
+// called once Monitor has returned, or by Monitor itself on the way out.
+// Output already queued stays readable until it is drained.
 func (cluster *AsyncClusterMonitor) onceDone() {
-	if atomic.LoadInt32(&cluster.StorageClosed) == ChannelClosed {
-		return
-	}
-
-	cluster.mapLock.Lock()
-	if cluster.StorageClosed == ChannelUnclosed {
-		close(cluster.Storage)
-		atomic.StoreInt32(&cluster.StorageClosed, ChannelClosed)
-	}
-	cluster.mapLock.Unlock()
+	cluster.closeOnce.Do(func() {
+		cluster.Subscriptions.closeStorage(cluster.Storage, &cluster.StorageClosed)
+		cluster.Subscriptions.closeAll()
+	})
 }
 
 // updateHostInfo updates the internal map with the given StatLine data.
@@ -345,6 +488,17 @@ func (cluster *AsyncClusterMonitor) updateHostInfo(stat *line.StatLine) {
 	defer cluster.mapLock.Unlock()
 	host := stat.Fields["host"]
 	cluster.LastStatLines[host] = stat
+
+	if stat.Error != nil {
+		delete(cluster.lastDataLines, host)
+		return
+	}
+	// the formatters mark the lines they printed, so keep a copy
+	if cluster.lastDataLines == nil {
+		cluster.lastDataLines = map[string]*line.StatLine{}
+	}
+	data := *stat
+	cluster.lastDataLines[host] = &data
 }
 
 // printSnapshot formats and dumps the current state of all the stats collected.
@@ -359,67 +513,84 @@ func (cluster *AsyncClusterMonitor) printSnapshot() bool {
 	if len(lines) == 0 {
 		return false
 	}
+	if cluster.Totals {
+		dataLines := make([]*line.StatLine, 0, len(cluster.lastDataLines))
+		for _, data := range cluster.lastDataLines {
+			dataLines = append(dataLines, data)
+		}
+		lines = append(lines, cluster.Consumer.AggregateLines(dataLines, len(cluster.LastStatLines))...)
+	}
 
-	str, finish := cluster.Consumer.FormatLines(lines)
-	cluster.Storage <- str
-	return finish
+	return cluster.Subscriptions.publish(cluster.ctx.Done(), cluster.Consumer, cluster.Storage, &cluster.StorageClosed, lines)
 }
 
 // Update sends a new StatLine on the cluster's report channel.
 func (cluster *AsyncClusterMonitor) Update(stat *status.ServerStatus, err *status.NodeError) {
 	if err != nil {
-		cluster.ErrorChan <- err
+		select {
+		case cluster.ErrorChan <- err:
+		case <-cluster.ctx.Done():
+		}
 		return
 	}
-	cluster.ReportChan <- stat
+	select {
+	case cluster.ReportChan <- stat:
+	case <-cluster.ctx.Done():
+	}
 }
 
 // The Async implementation of Monitor starts the goroutines that listen for incoming stat data,
 // and dump snapshots at a regular interval.
 func (cluster *AsyncClusterMonitor) Monitor(sleep time.Duration) error {
-	select {
-	case stat := <-cluster.ReportChan:
-		cluster.Consumer.Update(stat)
-	case err := <-cluster.ErrorChan:
-		// error out if the first result is an error
-		statLine := &line.StatLine{
-			Error:  err,
-			Fields: map[string]string{"host": err.Host},
-		}
-		cluster.updateHostInfo(statLine)
-
-		n := len(cluster.ErrorChan)
-		for i := 0; i < n; i++ {
-			err := <-cluster.ErrorChan
-			statLine := &line.StatLine{
-				Error:  err,
-				Fields: map[string]string{"host": err.Host},
+	defer cluster.onceDone()
+
+	// Wait for the first result, and error out if it is an error. A host
+	// that timed out, e.g. while connecting, may still catch up, so its
+	// timeouts are recorded and waited past.
+	for waiting := true; waiting; {
+		select {
+		case stat := <-cluster.ReportChan:
+			cluster.Consumer.UpdateWithRestart(stat)
+			waiting = false
+		case err := <-cluster.ErrorChan:
+			cluster.updateHostInfo(line.NewErrorStatLine(err))
+			if err.TimedOut() {
+				continue
+			}
+
+			n := len(cluster.ErrorChan)
+			for i := 0; i < n; i++ {
+				cluster.updateHostInfo(line.NewErrorStatLine(<-cluster.ErrorChan))
 			}
-			cluster.updateHostInfo(statLine)
+			cluster.printSnapshot()
+			return err
+		case <-cluster.ctx.Done():
+			return nil
 		}
-		cluster.printSnapshot()
-		//sleep 100ms 让channel有时间反应，将错误数据发送出去
-		time.Sleep(100 * time.Millisecond)
-		cluster.onceDone()
-		return err
 	}
 
+	// The collector must have exited before the output is closed, so it is
+	// stopped and waited for before onceDone runs.
+	collectorCtx, stopCollector := context.WithCancel(cluster.ctx)
+	var collector sync.WaitGroup
+	defer collector.Wait()
+	defer stopCollector()
+
+	collector.Add(1)
 	go func() {
+		defer collector.Done()
 		for {
 			select {
 			case stat := <-cluster.ReportChan:
-				statLine, ok := cluster.Consumer.Update(stat)
-				if ok {
+				statLine, restart := cluster.Consumer.UpdateWithRestart(stat)
+				if restart != nil {
+					cluster.updateHostInfo(line.NewErrorStatLine(restart))
+				} else if statLine != nil {
 					cluster.updateHostInfo(statLine)
 				}
 			case err := <-cluster.ErrorChan:
-				statLine := &line.StatLine{
-					Error:  err,
-					Fields: map[string]string{"host": err.Host},
-				}
-				cluster.updateHostInfo(statLine)
-			case <-cluster.ctx.Done():
-				cluster.onceDone()
+				cluster.updateHostInfo(line.NewErrorStatLine(err))
+			case <-collectorCtx.Done():
 				//fmt.Println("async cluster monitor goroutine ctx done")
 				return
 			}
@@ -427,22 +598,20 @@ func (cluster *AsyncClusterMonitor) Monitor(sleep time.Duration) error {
 	}()
 
 	ticker := time.NewTicker(sleep)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
 			//如果达到退出条件，输出了指定行数|达到指定的持续时间
 			timeout := time.Now().Unix()-cluster.startTime > cluster.during
 			if timeout || cluster.printSnapshot() {
-				cluster.onceDone()
 				return nil
 			}
 		case <-cluster.ctx.Done():
-			cluster.onceDone()
 			//fmt.Println("async cluster monitor ctx done")
 			return nil
 		}
 	}
-	return nil
 }
 
 // NewNodeMonitor copies the same connection settings from an instance of
@@ -469,16 +638,33 @@ func NewNodeMonitor(opts *options.ToolOptions, fullHost string) (*NodeMonitor, e
 	return &NodeMonitor{
 		host:            fullHost,
 		sessionProvider: sessionProvider,
+		poller:          &sessionPoller{sessionProvider: sessionProvider},
 		LastUpdate:      time.Now().Local(),
 		Err:             nil,
 	}, nil
 }
 
-// Report collects the stat info for a single node and sends found hostnames on
-// the "discover" channel if checkShards is true.
+// Poll collects the stat info for a single node through its Poller.
 func (node *NodeMonitor) Poll() (*status.ServerStatus, error) {
+	stat, err := node.poller.Poll()
+	if err != nil {
+		return nil, err
+	}
+
+	node.Err = nil
+	stat.SampleTime = time.Now().Local()
+
+	node.alias = stat.Host
+	stat.Host = node.host
+
+	return stat, nil
+}
+
+// Poll runs serverStatus, without its metrics section unless requested, and
+// replSetGetStatus for the lag, on the host.
+func (poller *sessionPoller) Poll() (*status.ServerStatus, error) {
 	stat := &status.ServerStatus{}
-	s, err := node.sessionProvider.GetSession()
+	s, err := poller.sessionProvider.GetSession()
 	if err != nil {
 		return nil, err
 	}
@@ -488,35 +674,105 @@ func (node *NodeMonitor) Poll() (*status.ServerStatus, error) {
 	// replset discovery mechanism since we do our own node discovery here.
 	s.SetMode(mgo.Eventual, true)
 
-	// Disable the socket timeout - otherwise if db.serverStatus() takes a long time on the server
-	// side, the client will close the connection early and report an error.
-	s.SetSocketTimeout(0)
+	// Bound the socket timeout by the poll deadline, so a hung host does not
+	// keep its connection busy forever.
+	s.SetSocketTimeout(poller.timeout)
 	defer s.Close()
 
-	err = s.DB("admin").Run(bson.D{{"serverStatus", 1}, {"recordStats", 0}}, stat)
+	cmd := bson.D{{"serverStatus", 1}, {"recordStats", 0}}
+	if !poller.pollMetrics {
+		cmd = append(cmd, bson.DocElem{"metrics", 0})
+	}
+
+	sent := time.Now()
+	err = s.DB("admin").Run(cmd, stat)
 	if err != nil {
 		return nil, err
 	}
+	stat.RTT = time.Since(sent)
+	if !stat.LocalTime.IsZero() {
+		// assume localTime was taken halfway through the round trip
+		stat.Skew = stat.LocalTime.Sub(sent.Add(stat.RTT / 2))
+	}
 
-	node.Err = nil
-	stat.SampleTime = time.Now().Local()
+	if poller.pollLag && status.IsReplSet(stat) {
+		stat.ReplLag = pollReplLag(s)
+	}
+	return stat, nil
+}
 
-	node.alias = stat.Host
-	stat.Host = node.host
+// pollReplLag computes the replication lag of the node. Lag is best effort:
+// if it cannot be determined the column is left empty rather than failing the
+// whole sample.
+func pollReplLag(s *mgo.Session) *status.ReplLag {
+	rsStatus := &status.ReplSetStatus{}
+	err := s.DB("admin").Run(bson.D{{"replSetGetStatus", 1}}, rsStatus)
+	if err != nil {
+		return nil
+	}
 
-	return stat, nil
+	rsConfig := &status.ReplSetConfig{}
+	err = s.DB("admin").Run(bson.D{{"replSetGetConfig", 1}}, rsConfig)
+	if err != nil {
+		rsConfig = nil
+	}
+	return status.NewReplLag(rsStatus, rsConfig)
+}
+
+// pollWithDeadline runs Poll, but gives up with status.ErrTimeout once the
+// node's timeout has passed. The hung poll is left to finish in the
+// background, and until it does the node keeps reporting a timeout.
+func (node *NodeMonitor) pollWithDeadline() (*status.ServerStatus, error) {
+	if !atomic.CompareAndSwapInt32(&node.polling, 0, 1) {
+		return nil, status.ErrTimeout
+	}
+
+	type pollResult struct {
+		stat *status.ServerStatus
+		err  error
+	}
+	done := make(chan pollResult, 1)
+	node.group.Add(1)
+	go func() {
+		defer node.group.Done()
+		defer atomic.StoreInt32(&node.polling, 0)
+		stat, err := node.Poll()
+		done <- pollResult{stat, err}
+	}()
+
+	deadline := time.NewTimer(node.timeout)
+	defer deadline.Stop()
+	select {
+	case res := <-done:
+		return res.stat, res.err
+	case <-deadline.C:
+		return nil, status.ErrTimeout
+	case <-node.ctx.Done():
+		return nil, node.ctx.Err()
+	}
+}
+
+// jitter returns the interval until a node's next poll, spread by up to 10%
+// either way so that the nodes are not all polled at the same instant.
+func jitter(sleep time.Duration) time.Duration {
+	spread := int64(sleep / 5)
+	if spread <= 0 {
+		return sleep
+	}
+	return sleep - time.Duration(spread/2) + time.Duration(rand.Int63n(spread))
 }
 
 // Watch continuously collects and processes stats for a single node on a
-// regular interval. At each interval, it triggers the node's Poll function
-// with the 'discover' channel.
+// regular interval. Each node is scheduled on its own, so a slow or hung node
+// never delays the polls of the others.
 func (node *NodeMonitor) Watch(sleep time.Duration, cluster ClusterMonitor) {
 
-	ticker := time.NewTicker(sleep)
+	timer := time.NewTimer(jitter(sleep))
+	defer timer.Stop()
 	for {
 		select {
-		case <-ticker.C:
-			stat, err := node.Poll()
+		case <-timer.C:
+			stat, err := node.pollWithDeadline()
 
 			var nodeError *status.NodeError
 			if err != nil {
@@ -524,6 +780,7 @@ func (node *NodeMonitor) Watch(sleep time.Duration, cluster ClusterMonitor) {
 				nodeError = status.NewNodeError(node.host, err)
 			}
 			cluster.Update(stat, nodeError)
+			timer.Reset(jitter(sleep))
 		case <-node.ctx.Done():
 			//fmt.Println(node.host, "ctx done")
 			return
@@ -544,6 +801,10 @@ func (mstat *MongoStat) AddNewNode(fullhost string) error {
 	mstat.nodesLock.Lock()
 	defer mstat.nodesLock.Unlock()
 
+	if mstat.ctx.Err() != nil {
+		return fmt.Errorf("mongostat is stopped")
+	}
+
 	// Remove the 'shardXX/' prefix from the hostname, if applicable
 	pieces := strings.Split(fullhost, "/")
 	fullhost = pieces[len(pieces)-1]
@@ -563,36 +824,109 @@ func (mstat *MongoStat) AddNewNode(fullhost string) error {
 	}
 
 	node.ctx = mstat.ctx
+	node.group = &mstat.group
+	node.timeout = pollTimeout(mstat.StatOptions, mstat.SleepInterval)
+	node.poller = &sessionPoller{
+		sessionProvider: node.sessionProvider,
+		pollLag:         mstat.StatOptions.ReplLag,
+		pollMetrics:     mstat.StatOptions.Metrics,
+		timeout:         node.timeout,
+	}
 
 	mstat.Nodes[fullhost] = node
 	//go node.Watch(mstat.SleepInterval, mstat.Discovered, mstat.Cluster)
-	go node.Watch(mstat.SleepInterval, mstat.Cluster)
+	mstat.group.Add(1)
+	go func() {
+		defer mstat.group.Done()
+		node.Watch(mstat.SleepInterval, mstat.Cluster)
+	}()
 	return nil
 }
 
 // Run is the top-level function that starts the monitoring
-// and discovery goroutines
+// and discovery goroutines. It returns once the monitor finishes, which
+// also stops the nodes. Run is meant to be called once.
 // https://docs.mongodb.com/v3.2/reference/program/mongostat/
 func (mstat *MongoStat) Run() error {
+	mstat.group.Add(1)
+	defer mstat.group.Done()
+	defer mstat.cancel()
 
+	if mstat.ctx.Err() != nil {
+		return nil
+	}
 	return mstat.Cluster.Monitor(mstat.SleepInterval)
 }
 
+// Wait blocks until Run, every node goroutine and every poll have exited.
+// Output queued by then stays readable through Message until drained;
+// output that could not be queued once the MongoStat stopped is dropped.
+func (mstat *MongoStat) Wait() {
+	mstat.group.Wait()
+}
+
+// Samples returns the typed sample stream of a MongoStat created with
+// NewMongoStatSamples, or nil for one that renders text.
+func (mstat *MongoStat) Samples() <-chan stat_consumer.Sample {
+	if cluster, ok := mstat.Cluster.(*SampleClusterMonitor); ok {
+		return cluster.Samples
+	}
+	return nil
+}
+
+// Subscribe adds a consumer of the output, rendered with its own formatter,
+// e.g. one from stat_consumer.FormatterConstructors. The nodes are still
+// polled only once. Up to buffer outputs, at least 1, are queued for the
+// subscriber, further ones are dropped until it catches up. Monitoring goes
+// on until the MongoStat's own formatter and those of every subscriber are
+// finished.
+func (mstat *MongoStat) Subscribe(formatter stat_consumer.LineFormatter, buffer int) (*Subscription, error) {
+	if mstat.subscriptions == nil {
+		return nil, fmt.Errorf("subscriptions are not supported by the mongostat sample stream")
+	}
+	return mstat.subscriptions.add(formatter, buffer)
+}
+
+// StorageDropped returns how many outputs were discarded from Message
+// because it was not read fast enough while there were subscribers.
+func (mstat *MongoStat) StorageDropped() int64 {
+	if mstat.subscriptions == nil {
+		return 0
+	}
+	return mstat.subscriptions.StorageDropped()
+}
+
+// Unsubscribe ends the subscription and closes its channel.
+func (mstat *MongoStat) Unsubscribe(sub *Subscription) {
+	if mstat.subscriptions != nil {
+		mstat.subscriptions.remove(sub)
+	}
+}
+
 func (mstat *MongoStat) Reset() {
 	mstat.Cluster.Reset()
 }
 
+// Stop ends monitoring, waits for everything to exit and then releases the
+// connections. It also closes the output if Run was never called.
 func (mstat *MongoStat) Stop() {
-	if mstat.cancel != nil {
-		mstat.cancel()
-		mstat.cancel = nil
-	}
+	mstat.cancel()
+	mstat.Wait()
 
-	//给ctx一点响应时间
-	time.Sleep(100 * time.Millisecond)
+	if cluster, ok := mstat.Cluster.(outputCloser); ok {
+		cluster.onceDone()
+	}
 
+	mstat.nodesLock.RLock()
+	defer mstat.nodesLock.RUnlock()
 	for _, node := range mstat.Nodes {
 		node.sessionProvider.Close()
 	}
 	//fmt.Println("Mongo Session Closed")
 }
+
+// outputCloser is implemented by the cluster monitors, to close their output
+// after Monitor returned.
+type outputCloser interface {
+	onceDone()
+}
@@ -0,0 +1,210 @@
+package mongostat
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xkeyideal/mongo-tools/mongostat/stat_consumer"
+	"github.com/xkeyideal/mongo-tools/mongostat/stat_consumer/line"
+	"github.com/xkeyideal/mongo-tools/mongostat/status"
+)
+
+// fakePoller answers immediately, or once hang is closed.
+type fakePoller struct {
+	hang chan struct{}
+}
+
+func (poller *fakePoller) Poll() (*status.ServerStatus, error) {
+	if poller.hang != nil {
+		<-poller.hang
+	}
+	return &status.ServerStatus{Host: "fake"}, nil
+}
+
+type update struct {
+	at  time.Time
+	err *status.NodeError
+}
+
+// recordingCluster records the updates of every host.
+type recordingCluster struct {
+	lock    sync.Mutex
+	updates map[string][]update
+}
+
+func (cluster *recordingCluster) Update(stat *status.ServerStatus, err *status.NodeError) {
+	cluster.lock.Lock()
+	defer cluster.lock.Unlock()
+	host := ""
+	if err != nil {
+		host = err.Host
+	} else {
+		host = stat.Host
+	}
+	cluster.updates[host] = append(cluster.updates[host], update{time.Now(), err})
+}
+
+func (cluster *recordingCluster) Monitor(time.Duration) error { return nil }
+func (cluster *recordingCluster) Message() (string, bool)     { return "", false }
+func (cluster *recordingCluster) Reset()                      {}
+
+func TestHungNodeDoesNotDelayOthers(t *testing.T) {
+	const (
+		sleep   = 50 * time.Millisecond
+		timeout = 300 * time.Millisecond
+		run     = time.Second
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var group sync.WaitGroup
+	hang := make(chan struct{})
+	cluster := &recordingCluster{updates: map[string][]update{}}
+
+	pollers := map[string]Poller{
+		"fast1:27017": &fakePoller{},
+		"fast2:27017": &fakePoller{},
+		"hung:27017":  &fakePoller{hang: hang},
+	}
+	for host, poller := range pollers {
+		node := &NodeMonitor{
+			host:    host,
+			poller:  poller,
+			timeout: timeout,
+			group:   &group,
+			ctx:     ctx,
+		}
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			node.Watch(sleep, cluster)
+		}()
+	}
+
+	time.Sleep(run)
+	cancel()
+	close(hang)
+	group.Wait()
+
+	for _, host := range []string{"fast1:27017", "fast2:27017"} {
+		updates := cluster.updates[host]
+		if len(updates) < int(run/sleep)/2 {
+			t.Errorf("%v: got %v updates in %v, polling every %v", host, len(updates), run, sleep)
+		}
+		for i, u := range updates {
+			if u.err != nil {
+				t.Errorf("%v: update %v failed: %v", host, i, u.err)
+			}
+			if i > 0 {
+				if gap := u.at.Sub(updates[i-1].at); gap >= timeout {
+					t.Errorf("%v: update %v came %v after the previous one, held up by the hung host", host, i, gap)
+				}
+			}
+		}
+	}
+
+	updates := cluster.updates["hung:27017"]
+	if len(updates) == 0 {
+		t.Fatalf("hung:27017: got no updates")
+	}
+	for i, u := range updates {
+		if u.err == nil || !u.err.TimedOut() {
+			t.Errorf("hung:27017: update %v is %v, not a timeout", i, u.err)
+		}
+	}
+}
+
+func TestNodeMonitorPollSetsHost(t *testing.T) {
+	node := &NodeMonitor{host: "localhost:27017", poller: &fakePoller{}}
+	stat, err := node.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Host != "localhost:27017" || node.alias != "fake" {
+		t.Errorf("got host %q and alias %q", stat.Host, node.alias)
+	}
+	if stat.SampleTime.IsZero() {
+		t.Errorf("sample time not set")
+	}
+}
+
+func TestPollTimeout(t *testing.T) {
+	tests := []struct {
+		pollTimeout int64
+		sleep       time.Duration
+		want        time.Duration
+	}{
+		{0, time.Second, DefaultPollTimeout},
+		{0, 10 * time.Second, 20 * time.Second},
+		{2, time.Second, 2 * time.Second},
+	}
+	for _, test := range tests {
+		got := pollTimeout(&StatOptions{PollTimeout: test.pollTimeout}, test.sleep)
+		if got != test.want {
+			t.Errorf("pollTimeout(%v, %v) = %v, want %v", test.pollTimeout, test.sleep, got, test.want)
+		}
+	}
+}
+
+func TestSubscriptionRequiresBuffer(t *testing.T) {
+	subs := newSubscriptions()
+	if _, err := subs.add(stat_consumer.NewGridLineFormatter(0, false), 0); err == nil {
+		t.Errorf("an unbuffered subscription was accepted")
+	}
+}
+
+func TestSubscribersOutliveOwnFormatter(t *testing.T) {
+	subs := newSubscriptions()
+	consumer := stat_consumer.NewStatConsumer(0, []string{"host"}, line.DefaultKeyMap(),
+		&status.ReaderConfig{}, stat_consumer.NewGridLineFormatter(1, false))
+	storage := make(chan string, 1)
+	var closed int32
+	done := make(chan struct{})
+	sub, err := subs.add(stat_consumer.NewGridLineFormatter(3, false), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := []*line.StatLine{line.NewErrorStatLine(status.NewNodeError("host:27017", status.ErrTimeout))}
+
+	// the own formatter takes one row: storage closes, the subscriber goes on
+	for i := 0; i < 2; i++ {
+		if subs.publish(done, consumer, storage, &closed, lines) {
+			t.Fatalf("publish %v finished the monitor while a subscriber wants more", i)
+		}
+		if _, ok := sub.Message(); !ok {
+			t.Fatalf("publish %v: subscription closed", i)
+		}
+	}
+	if _, ok := <-storage; !ok {
+		t.Fatalf("the first output was not stored")
+	}
+	if _, ok := <-storage; ok || closed != ChannelClosed {
+		t.Errorf("storage was not closed once its formatter finished")
+	}
+
+	// the subscriber takes its third and last row
+	if !subs.publish(done, consumer, storage, &closed, lines) {
+		t.Errorf("the monitor goes on once every formatter is finished")
+	}
+	subs.closeStorage(storage, &closed)
+}
+
+func TestStorageDropsAreCounted(t *testing.T) {
+	subs := newSubscriptions()
+	consumer := stat_consumer.NewStatConsumer(0, []string{"host"}, line.DefaultKeyMap(),
+		&status.ReaderConfig{}, stat_consumer.NewGridLineFormatter(0, false))
+	storage := make(chan string, 1)
+	var closed int32
+	if _, err := subs.add(stat_consumer.NewGridLineFormatter(0, false), 10); err != nil {
+		t.Fatal(err)
+	}
+	lines := []*line.StatLine{line.NewErrorStatLine(status.NewNodeError("host:27017", status.ErrTimeout))}
+
+	for i := 0; i < 3; i++ {
+		subs.publish(nil, consumer, storage, &closed, lines)
+	}
+	if dropped := subs.StorageDropped(); dropped != 2 {
+		t.Errorf("got %v storage drops, want 2", dropped)
+	}
+}
@@ -14,8 +14,15 @@ type StatOptions struct {
 	NoHeaders     bool  `long:"noheaders" description:"don't output column names"`
 	RowCount      int64 `long:"rowcount" value-name:"<count>" short:"n" description:"number of stats lines to print (0 for indefinite)"`
 	//Discover      bool   `long:"discover" description:"discover nodes and display stats for all"`
-	All  bool `long:"all" description:"all optional fields"`
-	Json bool `long:"json" description:"output as JSON rather than a formatted table"`
+	All           bool  `long:"all" description:"all optional fields"`
+	WTExtended    bool  `long:"wtExtended" description:"show the extended WiredTiger column group (tickets, eviction, cache pages, checkpoints)"`
+	ReplLag       bool  `long:"replLag" description:"show how far each replica set member is behind the primary"`
+	Metrics       bool  `long:"metrics" description:"show scanned keys/documents, documents returned and cursors from the serverStatus metrics section"`
+	Totals        bool  `long:"totals" description:"add a TOTAL row, and a row per replica set, summing the monitored hosts"`
+	PollTimeout   int64 `long:"pollTimeout" value-name:"<seconds>" description:"seconds to wait for a host before reporting it as timed out (0 for twice the polling interval, at least 5)"`
+	Clock         bool  `long:"clock" description:"show the round trip time and clock skew of each host"`
+	SkewThreshold int64 `long:"skewThreshold" value-name:"<ms>" description:"warn when a host's clock is more than this many milliseconds off the local clock (0 for 1000)"`
+	Json          bool  `long:"json" description:"output as JSON rather than a formatted table"`
 }
 
 // Name returns a human-readable group name for mongostat options.
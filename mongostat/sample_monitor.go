@@ -0,0 +1,96 @@
+package mongostat
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xkeyideal/mongo-tools/mongostat/stat_consumer"
+	"github.com/xkeyideal/mongo-tools/mongostat/status"
+)
+
+// SampleClusterMonitor is an implementation of ClusterMonitor that delivers
+// every poll of every host as a typed Sample instead of formatting it.
+type SampleClusterMonitor struct {
+	// Channel to listen for incoming stat data
+	ReportChan chan *status.ServerStatus
+
+	// Channel to listen for incoming errors
+	ErrorChan chan *status.NodeError
+
+	// Samples receives exactly one Sample per poll, except for the first
+	// successful poll of each host, which is the baseline for rates.
+	// It is closed when Monitor returns.
+	Samples   chan stat_consumer.Sample
+	closeOnce sync.Once
+
+	// Creates the Samples from ServerStatuses
+	Consumer *stat_consumer.StatConsumer
+
+	ctx context.Context
+}
+
+// Update sends the poll result on the cluster's report or error channel,
+// giving up if the monitor is shutting down.
+func (cluster *SampleClusterMonitor) Update(stat *status.ServerStatus, err *status.NodeError) {
+	if err != nil {
+		select {
+		case cluster.ErrorChan <- err:
+		case <-cluster.ctx.Done():
+		}
+		return
+	}
+	select {
+	case cluster.ReportChan <- stat:
+	case <-cluster.ctx.Done():
+	}
+}
+
+// Monitor turns incoming poll results into Samples until the context is done.
+// Errors do not stop the stream, they are delivered as Samples.
+func (cluster *SampleClusterMonitor) Monitor(_ time.Duration) error {
+	defer cluster.onceDone()
+
+	for {
+		var sample stat_consumer.Sample
+		select {
+		case stat := <-cluster.ReportChan:
+			var restart *status.NodeError
+			var ok bool
+			sample, restart, ok = cluster.Consumer.Sample(stat)
+			if restart != nil {
+				sample = stat_consumer.NewErrorSample(restart)
+				sample.Time = stat.SampleTime
+			} else if !ok {
+				continue
+			}
+		case err := <-cluster.ErrorChan:
+			sample = stat_consumer.NewErrorSample(err)
+		case <-cluster.ctx.Done():
+			return nil
+		}
+
+		select {
+		case cluster.Samples <- sample:
+		case <-cluster.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// onceDone closes the Samples channel, once Monitor has returned.
+func (cluster *SampleClusterMonitor) onceDone() {
+	cluster.closeOnce.Do(func() {
+		close(cluster.Samples)
+	})
+}
+
+// Message is not supported, the SampleClusterMonitor renders no text.
+// It always reports that there are no more messages; use Samples instead.
+func (cluster *SampleClusterMonitor) Message() (string, bool) {
+	return "", false
+}
+
+func (cluster *SampleClusterMonitor) Reset() {
+	cluster.Consumer.Reset()
+}
@@ -47,6 +47,7 @@ func (glf *GridLineFormatter) Finish() {
 // FormatLines formats the StatLines as a grid
 func (glf *GridLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []string, keyNames map[string]string) string {
 	buf := &bytes.Buffer{}
+	warnings := []string{}
 
 	// Sort the stat lines by hostname, so that we see the output
 	// in the same order for each snapshot
@@ -75,6 +76,9 @@ func (glf *GridLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []s
 			glf.WriteCell(l.Fields[key])
 		}
 		glf.EndRow()
+		if l.Warning != "" {
+			warnings = append(warnings, fmt.Sprintf("warning: %v: %v\n", l.Fields["host"], l.Warning))
+		}
 	}
 	glf.Flush(buf)
 
@@ -106,6 +110,7 @@ func (glf *GridLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []s
 		// For multi-node stats, add an extra newline to tell each block apart
 		gridLine = fmt.Sprintf("\n%s", gridLine)
 	}
+	gridLine = gridLine + strings.Join(warnings, "")
 	glf.increment()
 	return gridLine
 }
@@ -41,6 +41,9 @@ func (jlf *JSONLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []s
 		// check for error
 		if l.Error != nil {
 			lineJson["error"] = l.Error.Error()
+			if l.Restarted {
+				lineJson["restarted"] = true
+			}
 			jsonFormat[l.Fields["host"]] = lineJson
 			continue
 		}
@@ -48,6 +51,9 @@ func (jlf *JSONLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []s
 		for _, key := range headerKeys {
 			lineJson[keyNames[key]] = l.Fields[key]
 		}
+		if l.Warning != "" {
+			lineJson["warning"] = l.Warning
+		}
 		jsonFormat[l.Fields["host"]] = lineJson
 	}
 
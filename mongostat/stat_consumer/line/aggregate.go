@@ -0,0 +1,136 @@
+package line
+
+import (
+	"fmt"
+
+	"github.com/xkeyideal/mongo-tools/mongostat/status"
+)
+
+// Levels of the synthetic lines that aggregate several hosts.
+const (
+	AggregateNone     = iota // a line for a single host
+	AggregateSubtotal        // the sum of the hosts of one replica set
+	AggregateTotal           // the sum of all hosts
+)
+
+// TotalHost is the host name shown for the line aggregating all hosts.
+const TotalHost = "TOTAL"
+
+// An Aggregator combines the numbers several hosts reported for one part of
+// a column, e.g. the read side of "qrw", into the number of a total line.
+type Aggregator func(nums []float64) float64
+
+// AggregateSum adds up the numbers, e.g. for rates and counts.
+func AggregateSum(nums []float64) float64 {
+	var total float64
+	for _, n := range nums {
+		total += n
+	}
+	return total
+}
+
+// AggregateMax takes the largest number, e.g. for the busiest host's queue.
+func AggregateMax(nums []float64) float64 {
+	max := nums[0]
+	for _, n := range nums[1:] {
+		if n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// AggregateAvg takes the mean of the numbers.
+func AggregateAvg(nums []float64) float64 {
+	return AggregateSum(nums) / float64(len(nums))
+}
+
+// aggregateValues combines the values of the lines part by part. Values with
+// a different number of parts than the first one are left out.
+func aggregateValues(values [][]float64, aggregate Aggregator) []float64 {
+	var rows [][]float64
+	for _, v := range values {
+		if v == nil || (len(rows) > 0 && len(v) != len(rows[0])) {
+			continue
+		}
+		rows = append(rows, v)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	combined := make([]float64, len(rows[0]))
+	nums := make([]float64, len(rows))
+	for i := range combined {
+		for j, row := range rows {
+			nums[j] = row[i]
+		}
+		combined[i] = aggregate(nums)
+	}
+	return combined
+}
+
+// newAggregateLine creates a line at the given level whose values combine
+// the values of lines, according to the Aggregate of each StatHeader, and
+// are then formatted like the values of a single host.
+func newAggregateLine(host string, level int, lines []*StatLine, headerKeys []string, c *status.ReaderConfig) *StatLine {
+	l := &StatLine{
+		Fields:    map[string]string{"host": host},
+		Values:    map[string][]float64{},
+		Aggregate: level,
+	}
+	for _, key := range headerKeys {
+		header, ok := StatHeaders[key]
+		if !ok || header.Aggregate == nil || header.FormatValues == nil {
+			continue
+		}
+		values := make([][]float64, 0, len(lines))
+		for _, hostLine := range lines {
+			values = append(values, hostLine.Values[key])
+		}
+		if combined := aggregateValues(values, header.Aggregate); combined != nil {
+			l.Values[key] = combined
+			l.Fields[key] = header.FormatValues(c, combined)
+		}
+	}
+	return l
+}
+
+// NewAggregateLines creates a TOTAL line for the latest data lines of the
+// hosts, preceded by a subtotal line per replica set if they span more than
+// one set. hosts is the number of hosts monitored: when some of them have no
+// data, e.g. because their poll failed, the TOTAL line shows how many it
+// covers.
+func NewAggregateLines(lines []*StatLine, hosts int, headerKeys []string, c *status.ReaderConfig) []*StatLine {
+	var live []*StatLine
+	sets := map[string][]*StatLine{}
+	for _, l := range lines {
+		if l.Error != nil || l.Aggregate != AggregateNone {
+			continue
+		}
+		live = append(live, l)
+		set := l.Fields["set"]
+		sets[set] = append(sets[set], l)
+	}
+	if len(live) == 0 {
+		return nil
+	}
+
+	var aggregates []*StatLine
+	if len(sets) > 1 {
+		for set, setLines := range sets {
+			if set == "" {
+				continue
+			}
+			subtotal := newAggregateLine(TotalHost+" "+set, AggregateSubtotal, setLines, headerKeys, c)
+			subtotal.Fields["set"] = set
+			aggregates = append(aggregates, subtotal)
+		}
+	}
+
+	total := TotalHost
+	if len(live) < hosts {
+		total = fmt.Sprintf("%v %d/%d", TotalHost, len(live), hosts)
+	}
+	return append(aggregates, newAggregateLine(total, AggregateTotal, live, headerKeys, c))
+}
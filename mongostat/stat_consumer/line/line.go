@@ -1,6 +1,8 @@
 package line
 
 import (
+	"fmt"
+
 	"github.com/xkeyideal/mongo-tools/mongostat/status"
 )
 
@@ -9,6 +11,23 @@ type StatLine struct {
 	Fields  map[string]string
 	Error   error
 	Printed bool
+
+	// Values holds the numbers behind the numeric Fields, before formatting,
+	// keyed like Fields. A field of several numbers, e.g. "qrw", has them in
+	// the order they are displayed in.
+	Values map[string][]float64
+
+	// Restarted marks an error line that stands in for a sample which could
+	// not be diffed because the host restarted since the previous one.
+	Restarted bool
+
+	// Aggregate is the level of a synthetic line summing several hosts,
+	// or AggregateNone for the line of a single host.
+	Aggregate int
+
+	// Warning is set when the sample is usable but something about the host
+	// needs attention, such as its clock drifting away from the local one.
+	Warning string
 }
 
 type StatLines []*StatLine
@@ -17,7 +36,11 @@ func (slice StatLines) Len() int {
 	return len(slice)
 }
 
+// Less orders the lines by hostname, with the aggregate lines after the hosts.
 func (slice StatLines) Less(i, j int) bool {
+	if slice[i].Aggregate != slice[j].Aggregate {
+		return slice[i].Aggregate < slice[j].Aggregate
+	}
 	return slice[i].Fields["host"] < slice[j].Fields["host"]
 }
 
@@ -29,11 +52,17 @@ func (slice StatLines) Swap(i, j int) {
 func NewStatLine(oldStat, newStat *status.ServerStatus, headerKeys []string, c *status.ReaderConfig) *StatLine {
 	line := &StatLine{
 		Fields: make(map[string]string),
+		Values: make(map[string][]float64),
 	}
 	for _, key := range headerKeys {
-		_, ok := StatHeaders[key]
+		header, ok := StatHeaders[key]
 		if ok {
-			line.Fields[key] = StatHeaders[key].ReadField(c, newStat, oldStat)
+			line.Fields[key] = header.ReadField(c, newStat, oldStat)
+			if header.ReadValues != nil {
+				if values := header.ReadValues(newStat, oldStat); values != nil {
+					line.Values[key] = values
+				}
+			}
 		} else { //这个分支应该走不到,常规的输出项没有
 			//fmt.Println("InterpretField")
 			line.Fields[key] = status.InterpretField(key, newStat, oldStat)
@@ -42,5 +71,18 @@ func NewStatLine(oldStat, newStat *status.ServerStatus, headerKeys []string, c *
 	// We always need host and storage_engine, even if they aren't being displayed
 	line.Fields["host"] = StatHeaders["host"].ReadField(c, newStat, oldStat)
 	line.Fields["storage_engine"] = StatHeaders["storage_engine"].ReadField(c, newStat, oldStat)
+	if status.ClockDrifted(c, newStat) {
+		line.Warning = fmt.Sprintf("clock skew of %v", newStat.Skew)
+	}
 	return line
 }
+
+// NewErrorStatLine constructs the StatLine reported in place of a sample of
+// the host of err, either a failed poll or a restart.
+func NewErrorStatLine(err *status.NodeError) *StatLine {
+	return &StatLine{
+		Error:     err,
+		Fields:    map[string]string{"host": err.Host},
+		Restarted: err.Restarted(),
+	}
+}
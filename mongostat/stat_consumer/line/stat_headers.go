@@ -6,14 +6,19 @@ import (
 
 // Flags to determine cases when to activate/deactivate columns for output.
 const (
-	FlagAlways   = 1 << iota // always activate the column
-	FlagHosts                // only active if we may have multiple hosts
-	FlagDiscover             // only active when mongostat is in discover mode
-	FlagRepl                 // only active if one of the nodes being monitored is in a replset
-	FlagLocks                // only active if node is capable of calculating lock info
-	FlagAll                  // only active if mongostat was run with --all option
-	FlagMMAP                 // only active if node has mmap-specific fields
-	FlagWT                   // only active if node has wiredtiger-specific fields
+	FlagAlways     = 1 << iota // always activate the column
+	FlagHosts                  // only active if we may have multiple hosts
+	FlagDiscover               // only active when mongostat is in discover mode
+	FlagRepl                   // only active if one of the nodes being monitored is in a replset
+	FlagLocks                  // only active if node is capable of calculating lock info
+	FlagAll                    // only active if mongostat was run with --all option
+	FlagMMAP                   // only active if node has mmap-specific fields
+	FlagWT                     // only active if node has wiredtiger-specific fields
+	FlagWTExtended             // only active if mongostat was run with the extended wiredtiger column group
+	FlagReplLag                // only active if mongostat was run with the replication lag column
+	FlagMetrics                // only active if mongostat was run with the serverStatus metrics columns
+	FlagClock                  // only active if mongostat was run with the round trip time and clock skew columns
+	FlagLockWaits              // only active if node reports the time spent acquiring each lock resource
 )
 
 // StatHeader describes a single column for mongostat's terminal output,
@@ -22,6 +27,18 @@ type StatHeader struct {
 	// ReadField produces a particular field according to the StatHeader instance.
 	// Some fields are based on a diff, so both latest ServerStatuses are taken.
 	ReadField func(c *status.ReaderConfig, newStat, oldStat *status.ServerStatus) string
+
+	// ReadValues produces the numbers ReadField formats, for the typed
+	// Samples and the total rows. Nil for the fields which are not numbers.
+	ReadValues status.ValueReader
+
+	// FormatValues formats numbers of ReadValues like ReadField does, for
+	// the total rows.
+	FormatValues status.ValueFormatter
+
+	// Aggregate combines each number of the field of several hosts for the
+	// total rows. Nil if the field should be left empty in those rows.
+	Aggregate Aggregator
 }
 
 // StatHeaders are the complete set of data metrics supported by mongostat.
@@ -35,6 +52,9 @@ var (
 		"delete":         {"delete", "Delete opcounter (diff)", "delete"},
 		"getmore":        {"getmore", "GetMore opcounter (diff)", "getmore"},
 		"command":        {"command", "Command opcounter (diff)", "command"},
+		"scanned":        {"scanned", "Scanned index keys|documents (rate)", "sk|sd"},
+		"returned":       {"returned", "Documents returned (rate)", "ret"},
+		"cursors":        {"cursors", "Cursors open|timed out (diff)", "cur|to"},
 		"dirty":          {"dirty", "Cache dirty (percentage)", "% dirty"},
 		"used":           {"used", "Cache used (percentage)", "% used"},
 		"flushes":        {"flushes", "Number of flushes (diff)", "flushes"},
@@ -46,6 +66,12 @@ var (
 		"lrw":            {"lrw", "Lock acquire count, read|write (diff percentage)", "lr|lw %"},
 		"lrwt":           {"lrwt", "Lock acquire time, read|write (diff percentage)", "lrt|lwt"},
 		"locked_db":      {"locked_db", "Locked db info, '(db):(percentage)'", "locked"},
+		"lock_wait":      {"lock_wait", "Most waited on lock resource other than Global, '(resource):(percentage)', the waits of all operations over the interval, which may exceed 100%", "lock wait"},
+		"trw":            {"trw", "Tickets available, read|write", "tr|tw"},
+		"evict":          {"evict", "Pages evicted, application|worker threads (rate)", "ea|ew"},
+		"pages_rw":       {"pages_rw", "Cache pages, read into|written from (rate)", "pr|pw"},
+		"checkpoint":     {"checkpoint", "Checkpoint, running|most recent duration", "ckpt"},
+		"cache_in":       {"cache_in", "Bytes read into cache (rate)", "cacheIn"},
 		"qrw":            {"qrw", "Queued accesses, read|write", "qr|qw"},
 		"arw":            {"arw", "Active accesses, read|write", "ar|aw"},
 		"net_in":         {"net_in", "Network input (size)", "netIn"},
@@ -53,36 +79,51 @@ var (
 		"conn":           {"conn", "Current connection count", "conn"},
 		"set":            {"set", "FlagReplica set name", "set"},
 		"repl":           {"repl", "FlagReplica set type", "repl"},
+		"lag":            {"lag", "Replication lag beyond any configured slaveDelay, '*' marks delayed members", "lag"},
+		"rtt":            {"rtt", "Round trip time of the serverStatus call", "rtt"},
+		"skew":           {"skew", "Host clock ahead of the local clock, '!' past the warning threshold", "skew"},
 		"time":           {"time", "Time of sample", "time"},
 	}
 	StatHeaders = map[string]StatHeader{
-		"host":           {status.ReadHost},
-		"storage_engine": {status.ReadStorageEngine},
-		"insert":         {status.ReadInsert},
-		"query":          {status.ReadQuery},
-		"update":         {status.ReadUpdate},
-		"delete":         {status.ReadDelete},
-		"getmore":        {status.ReadGetMore},
-		"command":        {status.ReadCommand},
-		"dirty":          {status.ReadDirty},
-		"used":           {status.ReadUsed},
-		"flushes":        {status.ReadFlushes},
-		"mapped":         {status.ReadMapped},
-		"vsize":          {status.ReadVSize},
-		"res":            {status.ReadRes},
-		"nonmapped":      {status.ReadNonMapped},
-		"faults":         {status.ReadFaults},
-		"lrw":            {status.ReadLRW},
-		"lrwt":           {status.ReadLRWT},
-		"locked_db":      {status.ReadLockedDB},
-		"qrw":            {status.ReadQRW},
-		"arw":            {status.ReadARW},
-		"net_in":         {status.ReadNetIn},
-		"net_out":        {status.ReadNetOut},
-		"conn":           {status.ReadConn},
-		"set":            {status.ReadSet},
-		"repl":           {status.ReadRepl},
-		"time":           {status.ReadTime},
+		"host":           {status.ReadHost, nil, nil, nil},
+		"storage_engine": {status.ReadStorageEngine, nil, nil, nil},
+		"insert":         {status.ReadInsert, status.InsertValues, status.FormatOps, AggregateSum},
+		"query":          {status.ReadQuery, status.QueryValues, status.FormatOps, AggregateSum},
+		"update":         {status.ReadUpdate, status.UpdateValues, status.FormatOps, AggregateSum},
+		"delete":         {status.ReadDelete, status.DeleteValues, status.FormatOps, AggregateSum},
+		"getmore":        {status.ReadGetMore, status.GetMoreValues, status.FormatCounts, AggregateSum},
+		"command":        {status.ReadCommand, status.CommandValues, status.FormatCommandOps, AggregateSum},
+		"scanned":        {status.ReadScanned, status.ScannedValues, status.FormatCounts, AggregateSum},
+		"returned":       {status.ReadReturned, status.ReturnedValues, status.FormatCounts, AggregateSum},
+		"cursors":        {status.ReadCursors, status.CursorsValues, status.FormatCounts, AggregateSum},
+		"dirty":          {status.ReadDirty, status.DirtyValues, status.FormatPercentage, AggregateMax},
+		"used":           {status.ReadUsed, status.UsedValues, status.FormatPercentage, AggregateMax},
+		"flushes":        {status.ReadFlushes, status.FlushesValues, status.FormatCounts, AggregateSum},
+		"mapped":         {status.ReadMapped, status.MappedValues, status.FormatMegabytes, nil},
+		"vsize":          {status.ReadVSize, status.VSizeValues, status.FormatMegabytes, nil},
+		"res":            {status.ReadRes, status.ResValues, status.FormatMegabytes, nil},
+		"nonmapped":      {status.ReadNonMapped, status.NonMappedValues, status.FormatMegabytes, nil},
+		"faults":         {status.ReadFaults, status.FaultsValues, status.FormatCounts, AggregateSum},
+		"lrw":            {status.ReadLRW, status.LRWValues, status.FormatPercentages, AggregateMax},
+		"lrwt":           {status.ReadLRWT, status.LRWTValues, status.FormatCounts, AggregateMax},
+		"locked_db":      {status.ReadLockedDB, nil, nil, nil},
+		"lock_wait":      {status.ReadLockWait, nil, nil, nil},
+		"trw":            {status.ReadTRW, status.TRWValues, status.FormatCounts, AggregateSum},
+		"evict":          {status.ReadEvict, status.EvictValues, status.FormatCounts, AggregateSum},
+		"pages_rw":       {status.ReadPagesRW, status.PagesRWValues, status.FormatCounts, AggregateSum},
+		"checkpoint":     {status.ReadCheckpoint, status.CheckpointValues, status.FormatCheckpoint, nil},
+		"cache_in":       {status.ReadCacheIn, status.CacheInValues, status.FormatBytes, AggregateSum},
+		"qrw":            {status.ReadQRW, status.QRWValues, status.FormatCounts, AggregateMax},
+		"arw":            {status.ReadARW, status.ARWValues, status.FormatCounts, AggregateMax},
+		"net_in":         {status.ReadNetIn, status.NetInValues, status.FormatBits, AggregateSum},
+		"net_out":        {status.ReadNetOut, status.NetOutValues, status.FormatBits, AggregateSum},
+		"conn":           {status.ReadConn, status.ConnValues, status.FormatCounts, AggregateSum},
+		"set":            {status.ReadSet, nil, nil, nil},
+		"repl":           {status.ReadRepl, nil, nil, nil},
+		"lag":            {status.ReadLag, status.LagValues, status.FormatLag, nil},
+		"rtt":            {status.ReadRTT, status.RTTValues, status.FormatRTT, nil},
+		"skew":           {status.ReadSkew, status.SkewValues, status.FormatSkew, nil},
+		"time":           {status.ReadTime, nil, nil, nil},
 	}
 	CondHeaders = []struct {
 		Key  string
@@ -95,8 +136,16 @@ var (
 		{"delete", FlagAlways},
 		{"getmore", FlagAlways},
 		{"command", FlagAlways},
+		{"scanned", FlagMetrics},
+		{"returned", FlagMetrics},
+		{"cursors", FlagMetrics},
 		{"dirty", FlagWT},
 		{"used", FlagWT},
+		{"trw", FlagWT | FlagWTExtended},
+		{"evict", FlagWT | FlagWTExtended},
+		{"pages_rw", FlagWT | FlagWTExtended},
+		{"checkpoint", FlagWT | FlagWTExtended},
+		{"cache_in", FlagWT | FlagWTExtended},
 		{"flushes", FlagAlways},
 		{"mapped", FlagMMAP},
 		{"vsize", FlagAlways},
@@ -106,6 +155,7 @@ var (
 		{"lrw", FlagMMAP | FlagAll},
 		{"lrwt", FlagMMAP | FlagAll},
 		{"locked_db", FlagLocks},
+		{"lock_wait", FlagLockWaits},
 		{"qrw", FlagAlways},
 		{"arw", FlagAlways},
 		{"net_in", FlagAlways},
@@ -113,6 +163,9 @@ var (
 		{"conn", FlagAlways},
 		{"set", FlagRepl},
 		{"repl", FlagRepl},
+		{"lag", FlagRepl | FlagReplLag},
+		{"rtt", FlagClock},
+		{"skew", FlagClock},
 		{"time", FlagAlways},
 	}
 )
@@ -0,0 +1,76 @@
+package stat_consumer
+
+import (
+	"time"
+
+	"github.com/xkeyideal/mongo-tools/mongostat/status"
+)
+
+// Sample is the unformatted result of a single poll of a single host.
+type Sample struct {
+	Host string
+	Time time.Time
+
+	// Values maps the header keys of the numeric columns, e.g. "insert" or
+	// "qrw", to their numbers before formatting: rates per second, counts
+	// and gauges. A column of several numbers has them in the order
+	// mongostat displays them, e.g. insert is {own, replicated} and qrw is
+	// {read, write}. Empty if Err or TooSoon is set.
+	Values map[string][]float64
+
+	// Fields maps the header keys to the text mongostat would display for
+	// them, including the columns which are not numbers, like "repl".
+	Fields map[string]string
+
+	// Err is set if the poll failed or the host restarted since the previous poll.
+	Err error
+
+	// Restarted is set, along with Err, if the host restarted since the
+	// previous poll. This sample is then the baseline for the next rates.
+	Restarted bool
+
+	// Warning is set if the host's clock drifted past the skew threshold.
+	Warning string
+
+	// TooSoon is set if the poll came within status.MinSampleInterval of the
+	// previous one, too close for its rates to mean anything. The sample
+	// has no Values then, and the next one is diffed against the older poll.
+	TooSoon bool
+}
+
+// Sample takes in a ServerStatus like Update, but returns the typed Sample
+// rather than a StatLine meant for a LineFormatter. It returns false for the
+// first ServerStatus of a host, which only serves as the baseline for rates,
+// and the restart NodeError of Update for a host that restarted.
+func (sc *StatConsumer) Sample(newStat *status.ServerStatus) (Sample, *status.NodeError, bool) {
+	_, seen := sc.oldStats[newStat.Host]
+	l, restart := sc.UpdateWithRestart(newStat)
+	if restart != nil || !seen {
+		return Sample{}, restart, false
+	}
+
+	sample := Sample{
+		Host: newStat.Host,
+		Time: newStat.SampleTime,
+	}
+	if l == nil {
+		// still one sample per poll, but without rates
+		sample.TooSoon = true
+		return sample, nil, true
+	}
+	sample.Values = l.Values
+	sample.Fields = l.Fields
+	sample.Warning = l.Warning
+	return sample, nil, true
+}
+
+// NewErrorSample creates the Sample for a failed poll, or for the restart of
+// a host.
+func NewErrorSample(err *status.NodeError) Sample {
+	return Sample{
+		Host:      err.Host,
+		Time:      time.Now().Local(),
+		Err:       err,
+		Restarted: err.Restarted(),
+	}
+}
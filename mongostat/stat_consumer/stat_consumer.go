@@ -35,14 +35,36 @@ func NewStatConsumer(flags int, customHeaders []string, keyNames map[string]stri
 	return sc
 }
 
-// Update takes in a ServerStatus and returns a StatLine if it has a previous record
+// Update takes in a ServerStatus and returns a StatLine if it has a previous record.
+// If the host restarted since that record, the StatLine is an error line for
+// the restart. Use UpdateWithRestart to handle restarts separately.
 func (sc *StatConsumer) Update(newStat *status.ServerStatus) (l *line.StatLine, seen bool) {
+	l, restart := sc.UpdateWithRestart(newStat)
+	if restart != nil {
+		l = line.NewErrorStatLine(restart)
+	}
+	return l, l != nil
+}
+
+// UpdateWithRestart takes in a ServerStatus and returns a StatLine if it has a
+// previous record. If the host restarted since that record, newStat becomes the
+// new baseline and a NodeError wrapping status.ErrRestarted is returned instead
+// of diffing across the restart, for the cluster monitor to report like the
+// error of a poll.
+func (sc *StatConsumer) UpdateWithRestart(newStat *status.ServerStatus) (l *line.StatLine, restart *status.NodeError) {
 	oldStat, seen := sc.oldStats[newStat.Host]
-	sc.oldStats[newStat.Host] = newStat
 	if seen {
-		l = line.NewStatLine(oldStat, newStat, sc.headers, sc.readerConfig)
-		return
+		if newStat.SampleTime.Sub(oldStat.SampleTime) < status.MinSampleInterval {
+			// keep the older baseline so that the next rate covers a usable interval
+			return nil, nil
+		}
+		sc.oldStats[newStat.Host] = newStat
+		if status.HasRestarted(newStat, oldStat) {
+			return nil, status.NewNodeError(newStat.Host, status.ErrRestarted)
+		}
+		return line.NewStatLine(oldStat, newStat, sc.headers, sc.readerConfig), nil
 	}
+	sc.oldStats[newStat.Host] = newStat
 
 	if sc.flags != 0 {
 		if status.IsMMAP(newStat) { //mmapv1
@@ -53,9 +75,12 @@ func (sc *StatConsumer) Update(newStat *status.ServerStatus) (l *line.StatLine,
 		if status.IsReplSet(newStat) { //repl
 			sc.flags |= line.FlagRepl
 		}
-		//if status.HasLocks(newStat) {
-		//	sc.flags |= line.FlagLocks
-		//}
+		if status.HasLocks(newStat) {
+			sc.flags |= line.FlagLocks
+		}
+		if status.HasLockWaits(newStat) {
+			sc.flags |= line.FlagLockWaits
+		}
 
 		// Modify headers,决定哪些数据会被输出
 		sc.headers = []string{}
@@ -69,6 +94,22 @@ func (sc *StatConsumer) Update(newStat *status.ServerStatus) (l *line.StatLine,
 	return
 }
 
+// Headers returns the keys of the columns currently being output.
+func (sc *StatConsumer) Headers() []string {
+	return sc.headers
+}
+
+// AggregateLines creates the TOTAL and per replica set lines of the latest
+// data lines of the hosts, out of hosts monitored, see line.NewAggregateLines.
+func (sc *StatConsumer) AggregateLines(lines []*line.StatLine, hosts int) []*line.StatLine {
+	return line.NewAggregateLines(lines, hosts, sc.headers, sc.readerConfig)
+}
+
+// KeyNames returns the names the columns are displayed with.
+func (sc *StatConsumer) KeyNames() map[string]string {
+	return sc.keyNames
+}
+
 // FormatLines consumes StatLines, formats them, and sends them to its writer
 // It returns true if the formatter should no longer receive data
 func (sc *StatConsumer) FormatLines(lines []*line.StatLine) (string, bool) {
@@ -13,6 +13,7 @@ import (
 type ReaderConfig struct {
 	HumanReadable bool
 	TimeFormat    string
+	SkewThreshold time.Duration
 }
 
 type LockUsage struct {
@@ -42,6 +43,13 @@ func formatBits(should bool, amt int64) string {
 	return fmt.Sprintf("%v", amt)
 }
 
+func formatBytes(should bool, amt int64) string {
+	if should {
+		return text.FormatByteAmount(amt)
+	}
+	return fmt.Sprintf("%v", amt)
+}
+
 func formatMegabyteAmount(should bool, amt int64) string {
 	if should {
 		return text.FormatMegabyteAmount(amt)
@@ -87,6 +95,26 @@ func parseLocks(stat *ServerStatus) map[string]LockUsage {
 	return returnVal
 }
 
+// parseAcquireLocks is the 3.0+ counterpart of parseLocks. Those servers no
+// longer report time spent holding a lock, so the time spent waiting to
+// acquire it is used as the measure of contention instead. Their locks are
+// keyed by resource type rather than by database, and the Global resource,
+// which every operation takes, is skipped like the '.' entry of parseLocks.
+func parseAcquireLocks(stat *ServerStatus) map[string]LockUsage {
+	returnVal := map[string]LockUsage{}
+	for namespace, lockInfo := range stat.Locks {
+		if lockInfo.AcquireCount == nil || namespace == "Global" {
+			continue
+		}
+		returnVal[namespace] = LockUsage{
+			namespace,
+			lockInfo.TimeAcquiringMicros.Read + lockInfo.TimeAcquiringMicros.ReadLower,
+			lockInfo.TimeAcquiringMicros.Write + lockInfo.TimeAcquiringMicros.WriteLower,
+		}
+	}
+	return returnVal
+}
+
 func computeLockDiffs(prevLocks, curLocks map[string]LockUsage) []LockUsage {
 	lockUsages := lockUsages(make([]LockUsage, 0, len(curLocks)))
 	for namespace, curUsage := range curLocks {
@@ -109,30 +137,77 @@ func computeLockDiffs(prevLocks, curLocks map[string]LockUsage) []LockUsage {
 	return lockUsages
 }
 
+// sampleSeconds returns the time between two samples. The server's localTime
+// is used when both samples have it, so that rates are not skewed by network
+// latency; otherwise the time the samples arrived is used.
+func sampleSeconds(newStat, oldStat *ServerStatus) float64 {
+	if !newStat.LocalTime.IsZero() && !oldStat.LocalTime.IsZero() {
+		if elapsed := newStat.LocalTime.Sub(oldStat.LocalTime); elapsed > 0 {
+			return elapsed.Seconds()
+		}
+	}
+	return newStat.SampleTime.Sub(oldStat.SampleTime).Seconds()
+}
+
+// ClockDrifted reports whether the host's clock is further off the local clock
+// than the configured threshold.
+func ClockDrifted(c *ReaderConfig, stat *ServerStatus) bool {
+	if stat.LocalTime.IsZero() {
+		return false
+	}
+	return skewDrifted(c, stat.Skew)
+}
+
+func skewDrifted(c *ReaderConfig, skew time.Duration) bool {
+	threshold := c.SkewThreshold
+	if threshold <= 0 {
+		threshold = DefaultSkewThreshold
+	}
+	return skew > threshold || skew < -threshold
+}
+
 func diff(newVal, oldVal int64, sampleSecs float64) int64 {
+	if sampleSecs <= 0 {
+		return 0
+	}
 	return int64(float64(newVal-oldVal) / sampleSecs)
 }
 
-func diffOp(newStat, oldStat *ServerStatus, f func(*OpcountStats) int64, both bool) string {
-	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
-	var opcount int64
-	var opcountRepl int64
-	if newStat.Opcounters != nil && oldStat.Opcounters != nil {
-		opcount = diff(f(newStat.Opcounters), f(oldStat.Opcounters), sampleSecs)
+// opcountRegressed reports whether any counter in newOps went backwards.
+func opcountRegressed(newOps, oldOps *OpcountStats) bool {
+	if newOps == nil || oldOps == nil {
+		return false
 	}
-	if newStat.OpcountersRepl != nil && oldStat.OpcountersRepl != nil {
-		opcountRepl = diff(f(newStat.OpcountersRepl), f(oldStat.OpcountersRepl), sampleSecs)
+	return newOps.Insert < oldOps.Insert ||
+		newOps.Query < oldOps.Query ||
+		newOps.Update < oldOps.Update ||
+		newOps.Delete < oldOps.Delete ||
+		newOps.GetMore < oldOps.GetMore ||
+		newOps.Command < oldOps.Command
+}
+
+// HasRestarted reports whether newStat cannot be diffed against oldStat,
+// either because the process changed (pid or uptime went backwards) or because
+// one of the cumulative counters mongostat reports rates for was reset.
+func HasRestarted(newStat, oldStat *ServerStatus) bool {
+	if newStat.Pid != 0 && oldStat.Pid != 0 && newStat.Pid != oldStat.Pid {
+		return true
 	}
-	switch {
-	case both || opcount > 0 && opcountRepl > 0:
-		return fmt.Sprintf("%v|%v", opcount, opcountRepl)
-	case opcount > 0:
-		return fmt.Sprintf("%v", opcount)
-	case opcountRepl > 0:
-		return fmt.Sprintf("*%v", opcountRepl)
-	default:
-		return "*0"
+	if newStat.Uptime < oldStat.Uptime || newStat.UptimeMillis < oldStat.UptimeMillis {
+		return true
+	}
+	if opcountRegressed(newStat.Opcounters, oldStat.Opcounters) ||
+		opcountRegressed(newStat.OpcountersRepl, oldStat.OpcountersRepl) {
+		return true
 	}
+	if newStat.Network != nil && oldStat.Network != nil {
+		if newStat.Network.BytesIn < oldStat.Network.BytesIn ||
+			newStat.Network.BytesOut < oldStat.Network.BytesOut ||
+			newStat.Network.NumRequests < oldStat.Network.NumRequests {
+			return true
+		}
+	}
+	return false
 }
 
 func getStorageEngine(stat *ServerStatus) string {
@@ -179,255 +254,199 @@ func ReadStorageEngine(_ *ReaderConfig, newStat, _ *ServerStatus) string {
 	return getStorageEngine(newStat)
 }
 
-func ReadInsert(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
-	return diffOp(newStat, oldStat, func(o *OpcountStats) int64 {
-		return o.Insert
-	}, false)
+func ReadInsert(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatOps, InsertValues(newStat, oldStat))
 }
 
-func ReadQuery(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
-	return diffOp(newStat, oldStat, func(s *OpcountStats) int64 {
-		return s.Query
-	}, false)
+func ReadQuery(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatOps, QueryValues(newStat, oldStat))
 }
 
-func ReadUpdate(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
-	return diffOp(newStat, oldStat, func(s *OpcountStats) int64 {
-		return s.Update
-	}, false)
+func ReadUpdate(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatOps, UpdateValues(newStat, oldStat))
 }
 
-func ReadDelete(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
-	return diffOp(newStat, oldStat, func(s *OpcountStats) int64 {
-		return s.Delete
-	}, false)
+func ReadDelete(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatOps, DeleteValues(newStat, oldStat))
 }
 
-func ReadGetMore(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
-	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
-	return fmt.Sprintf("%d", diff(newStat.Opcounters.GetMore, oldStat.Opcounters.GetMore, sampleSecs))
+func ReadGetMore(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCounts, GetMoreValues(newStat, oldStat))
 }
 
-func ReadCommand(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
-	return diffOp(newStat, oldStat, func(s *OpcountStats) int64 {
-		return s.Command
-	}, true)
+func ReadCommand(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCommandOps, CommandValues(newStat, oldStat))
 }
 
-func ReadDirty(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
-	if newStat.WiredTiger != nil {
-		bytes := float64(newStat.WiredTiger.Cache.TrackedDirtyBytes)
-		max := float64(newStat.WiredTiger.Cache.MaxBytesConfigured)
-		if max != 0 {
-			val = fmt.Sprintf("%.1f", 100*bytes/max)
-			if c.HumanReadable {
-				val = val + "%"
-			}
-		}
-	}
-	return
+func ReadScanned(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCounts, ScannedValues(newStat, oldStat))
 }
 
-func ReadUsed(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
-	if newStat.WiredTiger != nil {
-		bytes := float64(newStat.WiredTiger.Cache.CurrentCachedBytes)
-		max := float64(newStat.WiredTiger.Cache.MaxBytesConfigured)
-		if max != 0 {
-			val = fmt.Sprintf("%.1f", 100*bytes/max)
-			if c.HumanReadable {
-				val = val + "%"
-			}
-		}
-	}
-	return
+func ReadReturned(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCounts, ReturnedValues(newStat, oldStat))
 }
 
-func ReadFlushes(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
-	var val int64
-	if newStat.WiredTiger != nil && oldStat.WiredTiger != nil {
-		val = newStat.WiredTiger.Transaction.TransCheckpoints - oldStat.WiredTiger.Transaction.TransCheckpoints
-	} else if newStat.BackgroundFlushing != nil && oldStat.BackgroundFlushing != nil {
-		val = newStat.BackgroundFlushing.Flushes - oldStat.BackgroundFlushing.Flushes
-	}
-	return fmt.Sprintf("%d", val)
+func ReadCursors(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCounts, CursorsValues(newStat, oldStat))
 }
 
-func ReadMapped(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
-	if util.IsTruthy(newStat.Mem.Supported) && IsMongos(newStat) {
-		val = formatMegabyteAmount(c.HumanReadable, newStat.Mem.Mapped)
-	}
-	return
+func ReadDirty(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatPercentage, DirtyValues(newStat, oldStat))
 }
 
-func ReadVSize(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
-	if util.IsTruthy(newStat.Mem.Supported) {
-		val = formatMegabyteAmount(c.HumanReadable, newStat.Mem.Virtual)
-	}
-	return
+func ReadUsed(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatPercentage, UsedValues(newStat, oldStat))
 }
 
-func ReadRes(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
-	if util.IsTruthy(newStat.Mem.Supported) {
-		val = formatMegabyteAmount(c.HumanReadable, newStat.Mem.Resident)
-	}
-	return
+func ReadFlushes(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCounts, FlushesValues(newStat, oldStat))
 }
 
-func ReadNonMapped(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
-	if util.IsTruthy(newStat.Mem.Supported) && !IsMongos(newStat) {
-		val = formatMegabyteAmount(c.HumanReadable, newStat.Mem.Virtual-newStat.Mem.Mapped)
-	}
-	return
+func ReadMapped(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatMegabytes, MappedValues(newStat, oldStat))
+}
+
+func ReadVSize(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatMegabytes, VSizeValues(newStat, oldStat))
+}
+
+func ReadRes(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatMegabytes, ResValues(newStat, oldStat))
+}
+
+func ReadNonMapped(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatMegabytes, NonMappedValues(newStat, oldStat))
 }
 
-func ReadFaults(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
+func ReadFaults(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
 	if !IsMMAP(newStat) {
 		return "n/a"
 	}
-	var val int64 = -1
-	if oldStat.ExtraInfo != nil && newStat.ExtraInfo != nil &&
-		oldStat.ExtraInfo.PageFaults != nil && newStat.ExtraInfo.PageFaults != nil {
-		sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
-		val = diff(*(newStat.ExtraInfo.PageFaults), *(oldStat.ExtraInfo.PageFaults), sampleSecs)
-	}
-	return fmt.Sprintf("%d", val)
-}
-
-func ReadLRW(_ *ReaderConfig, newStat, oldStat *ServerStatus) (val string) {
-	if !IsMongos(newStat) && newStat.Locks != nil && oldStat.Locks != nil {
-		global, ok := oldStat.Locks["Global"]
-		if ok && global.AcquireCount != nil {
-			newColl, inNew := newStat.Locks["Collection"]
-			oldColl, inOld := oldStat.Locks["Collection"]
-			if inNew && inOld && newColl.AcquireWaitCount != nil && oldColl.AcquireWaitCount != nil {
-				rWait := newColl.AcquireWaitCount.Read - oldColl.AcquireWaitCount.Read
-				wWait := newColl.AcquireWaitCount.Write - oldColl.AcquireWaitCount.Write
-				rTotal := newColl.AcquireCount.Read - oldColl.AcquireCount.Read
-				wTotal := newColl.AcquireCount.Write - oldColl.AcquireCount.Write
-				r := percentageInt64(rWait, rTotal)
-				w := percentageInt64(wWait, wTotal)
-				val = fmt.Sprintf("%.1f%%|%.1f%%", r, w)
-			}
-		}
+	values := FaultsValues(newStat, oldStat)
+	if values == nil {
+		return "-1"
 	}
-	return
+	return FormatCounts(c, values)
 }
 
-func ReadLRWT(_ *ReaderConfig, newStat, oldStat *ServerStatus) (val string) {
-	if !IsMongos(newStat) && newStat.Locks != nil && oldStat.Locks != nil {
-		global, ok := oldStat.Locks["Global"]
-		if ok && global.AcquireCount != nil {
-			newColl, inNew := newStat.Locks["Collection"]
-			oldColl, inOld := oldStat.Locks["Collection"]
-			if inNew && inOld && newColl.AcquireWaitCount != nil && oldColl.AcquireWaitCount != nil {
-				rWait := newColl.AcquireWaitCount.Read - oldColl.AcquireWaitCount.Read
-				wWait := newColl.AcquireWaitCount.Write - oldColl.AcquireWaitCount.Write
-				rAcquire := newColl.TimeAcquiringMicros.Read - oldColl.TimeAcquiringMicros.Read
-				wAcquire := newColl.TimeAcquiringMicros.Write - oldColl.TimeAcquiringMicros.Write
-				r := averageInt64(rAcquire, rWait)
-				w := averageInt64(wAcquire, wWait)
-				val = fmt.Sprintf("%v|%v", r, w)
-			}
-		}
+func ReadLRW(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatPercentages, LRWValues(newStat, oldStat))
+}
+
+func ReadLRWT(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCounts, LRWTValues(newStat, oldStat))
+}
+
+// ReadLockWait reports the most waited on lock resource of a 3.0+ server
+// other than Global, e.g. Collection or oplog, and the time spent waiting to
+// acquire it as a percentage of the interval. The waits of concurrent
+// operations add up, so the percentage may exceed 100%.
+func ReadLockWait(_ *ReaderConfig, newStat, oldStat *ServerStatus) (val string) {
+	if IsMongos(newStat) || !HasLockWaits(newStat) || !HasLockWaits(oldStat) {
+		return
 	}
-	return
+	lockdiffs := computeLockDiffs(parseAcquireLocks(oldStat), parseAcquireLocks(newStat))
+	if len(lockdiffs) == 0 {
+		return
+	}
+	highestLocked := lockdiffs[len(lockdiffs)-1]
+	// lock data is in microseconds and uptime is in milliseconds
+	timeDiffMicros := (newStat.UptimeMillis - oldStat.UptimeMillis) * 1000
+	percentage := percentageInt64(highestLocked.Reads+highestLocked.Writes, timeDiffMicros)
+	return fmt.Sprintf("%s:%.1f%%", highestLocked.Namespace, percentage)
 }
 
+// HasLockWaits reports whether the server reports the time spent acquiring
+// each lock resource, as 3.0+ servers do.
+func HasLockWaits(stat *ServerStatus) bool {
+	if stat.Locks == nil {
+		return false
+	}
+	global, ok := stat.Locks["Global"]
+	return ok && global.AcquireCount != nil
+}
+
+// ReadLockedDB reports the most locked database of a 2.x server and the
+// percentage of the interval it was write locked. 3.0+ servers lock
+// resources rather than databases, see ReadLockWait.
 func ReadLockedDB(_ *ReaderConfig, newStat, oldStat *ServerStatus) (val string) {
-	if !IsMongos(newStat) && newStat.Locks != nil && oldStat.Locks != nil {
-		global, ok := oldStat.Locks["Global"]
-		if !ok || global.AcquireCount == nil {
-			prevLocks := parseLocks(oldStat)
-			curLocks := parseLocks(newStat)
-			lockdiffs := computeLockDiffs(prevLocks, curLocks)
-			db := ""
-			var percentage string
-			if len(lockdiffs) == 0 {
-				if newStat.GlobalLock != nil {
-					percentage = fmt.Sprintf("%.1f", percentageInt64(newStat.GlobalLock.LockTime, newStat.GlobalLock.TotalTime))
-				}
-			} else {
-				// Get the entry with the highest lock
-				highestLocked := lockdiffs[len(lockdiffs)-1]
-				timeDiffMillis := newStat.UptimeMillis - oldStat.UptimeMillis
-				lockToReport := highestLocked.Writes
-
-				// if the highest locked namespace is not '.'
-				if highestLocked.Namespace != "." {
-					for _, namespaceLockInfo := range lockdiffs {
-						if namespaceLockInfo.Namespace == "." {
-							lockToReport += namespaceLockInfo.Writes
-						}
+	if !IsMongos(newStat) && newStat.Locks != nil && oldStat.Locks != nil && !HasLockWaits(oldStat) {
+		prevLocks := parseLocks(oldStat)
+		curLocks := parseLocks(newStat)
+		lockdiffs := computeLockDiffs(prevLocks, curLocks)
+		db := ""
+		var percentage string
+		if len(lockdiffs) == 0 {
+			if newStat.GlobalLock != nil {
+				percentage = fmt.Sprintf("%.1f", percentageInt64(newStat.GlobalLock.LockTime, newStat.GlobalLock.TotalTime))
+			}
+		} else {
+			// Get the entry with the highest lock
+			highestLocked := lockdiffs[len(lockdiffs)-1]
+			timeDiffMillis := newStat.UptimeMillis - oldStat.UptimeMillis
+			lockToReport := highestLocked.Writes
+
+			// if the highest locked namespace is not '.'
+			if highestLocked.Namespace != "." {
+				for _, namespaceLockInfo := range lockdiffs {
+					if namespaceLockInfo.Namespace == "." {
+						lockToReport += namespaceLockInfo.Writes
 					}
 				}
+			}
 
-				// lock data is in microseconds and uptime is in milliseconds - so
-				// divide by 1000 so that the units match
-				lockToReport /= 1000
+			// lock data is in microseconds and uptime is in milliseconds - so
+			// divide by 1000 so that the units match
+			lockToReport /= 1000
 
-				db = highestLocked.Namespace
-				percentage = fmt.Sprintf("%.1f", percentageInt64(lockToReport, timeDiffMillis))
-			}
-			if percentage != "" {
-				val = fmt.Sprintf("%s:%s%%", db, percentage)
-			}
+			db = highestLocked.Namespace
+			percentage = fmt.Sprintf("%.1f", percentageInt64(lockToReport, timeDiffMillis))
+		}
+		if percentage != "" {
+			val = fmt.Sprintf("%s:%s%%", db, percentage)
 		}
 	}
 	return
 }
 
-func ReadQRW(_ *ReaderConfig, newStat, _ *ServerStatus) string {
-	var qr int64
-	var qw int64
-	gl := newStat.GlobalLock
-	if gl != nil && gl.CurrentQueue != nil {
-		// If we have wiredtiger stats, use those instead
-		if newStat.WiredTiger != nil {
-			qr = gl.CurrentQueue.Readers + gl.ActiveClients.Readers - newStat.WiredTiger.Concurrent.Read.Out
-			qw = gl.CurrentQueue.Writers + gl.ActiveClients.Writers - newStat.WiredTiger.Concurrent.Write.Out
-			if qr < 0 {
-				qr = 0
-			}
-			if qw < 0 {
-				qw = 0
-			}
-		} else {
-			qr = gl.CurrentQueue.Readers
-			qw = gl.CurrentQueue.Writers
-		}
-	}
-	return fmt.Sprintf("%v|%v", qr, qw)
+func ReadQRW(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCounts, QRWValues(newStat, oldStat))
 }
 
-func ReadARW(_ *ReaderConfig, newStat, _ *ServerStatus) string {
-	var ar int64
-	var aw int64
-	if gl := newStat.GlobalLock; gl != nil {
-		if newStat.WiredTiger != nil {
-			ar = newStat.WiredTiger.Concurrent.Read.Out
-			aw = newStat.WiredTiger.Concurrent.Write.Out
-		} else if newStat.GlobalLock.ActiveClients != nil {
-			ar = gl.ActiveClients.Readers
-			aw = gl.ActiveClients.Writers
-		}
-	}
-	return fmt.Sprintf("%v|%v", ar, aw)
+func ReadARW(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCounts, ARWValues(newStat, oldStat))
+}
+
+func ReadTRW(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCounts, TRWValues(newStat, oldStat))
+}
+
+func ReadEvict(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCounts, EvictValues(newStat, oldStat))
+}
+
+func ReadPagesRW(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCounts, PagesRWValues(newStat, oldStat))
+}
+
+func ReadCheckpoint(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCheckpoint, CheckpointValues(newStat, oldStat))
+}
+
+func ReadCacheIn(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatBytes, CacheInValues(newStat, oldStat))
 }
 
 func ReadNetIn(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
-	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
-	val := diff(newStat.Network.BytesIn, oldStat.Network.BytesIn, sampleSecs)
-	return formatBits(c.HumanReadable, val)
+	return FormatValues(c, FormatBits, NetInValues(newStat, oldStat))
 }
 
 func ReadNetOut(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
-	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
-	val := diff(newStat.Network.BytesOut, oldStat.Network.BytesOut, sampleSecs)
-	return formatBits(c.HumanReadable, val)
+	return FormatValues(c, FormatBits, NetOutValues(newStat, oldStat))
 }
 
-func ReadConn(_ *ReaderConfig, newStat, _ *ServerStatus) string {
-	return fmt.Sprintf("%d", newStat.Connections.Current)
+func ReadConn(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatCounts, ConnValues(newStat, oldStat))
 }
 
 func ReadSet(_ *ReaderConfig, newStat, _ *ServerStatus) (name string) {
@@ -461,6 +480,23 @@ func ReadRepl(_ *ReaderConfig, newStat, _ *ServerStatus) string {
 	}
 }
 
+// ReadLag reports how far the host is behind its primary, not counting any
+// configured slaveDelay. Delayed members are marked with a '*'.
+func ReadLag(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatLag, LagValues(newStat, oldStat))
+}
+
+// ReadRTT reports the round trip time of the serverStatus call in milliseconds.
+func ReadRTT(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatRTT, RTTValues(newStat, oldStat))
+}
+
+// ReadSkew reports how far the host's clock is ahead of the local clock in
+// milliseconds, marked with a '!' once it drifts past the threshold.
+func ReadSkew(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return FormatValues(c, FormatSkew, SkewValues(newStat, oldStat))
+}
+
 func ReadTime(c *ReaderConfig, newStat, _ *ServerStatus) string {
 	if c.TimeFormat != "" {
 		return newStat.SampleTime.Format(c.TimeFormat)
@@ -493,7 +529,7 @@ func ReadStatDiff(field string, newStat, oldStat *ServerStatus) string {
 }
 
 func ReadStatRate(field string, newStat, oldStat *ServerStatus) string {
-	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
+	sampleSecs := sampleSeconds(newStat, oldStat)
 	new, validNew := newStat.Flattened[field]
 	old, validOld := oldStat.Flattened[field]
 	if validNew && validOld {
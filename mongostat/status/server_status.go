@@ -1,6 +1,9 @@
 package status
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 type ServerStatus struct {
 	SampleTime         time.Time              `bson:"" json:"time"`
@@ -29,6 +32,16 @@ type ServerStatus struct {
 	ShardCursorType    map[string]interface{} `bson:"shardCursorType" json:"shardCursorType"`
 	StorageEngine      map[string]string      `bson:"storageEngine" json:"storageEngine"`
 	WiredTiger         *WiredTiger            `bson:"wiredTiger" json:"wiredTiger"`
+	Metrics            *MetricsStats          `bson:"metrics,omitempty" json:"metrics,omitempty"`
+
+	// ReplLag is not part of serverStatus, it is filled in from
+	// replSetGetStatus when mongostat is asked for the lag column.
+	ReplLag *ReplLag `bson:"-" json:"replLag,omitempty"`
+
+	// RTT and Skew are measured by the poller around the serverStatus call:
+	// the round trip time, and how far localTime is ahead of the local clock.
+	RTT  time.Duration `bson:"-" json:"rtt"`
+	Skew time.Duration `bson:"-" json:"skew"`
 }
 
 // WiredTiger stores information related to the WiredTiger storage engine.
@@ -44,7 +57,9 @@ type ConcurrentTransactions struct {
 }
 
 type ConcurrentTransStats struct {
-	Out int64 `bson:"out" json:"out"`
+	Out          int64 `bson:"out" json:"out"`
+	Available    int64 `bson:"available" json:"available"`
+	TotalTickets int64 `bson:"totalTickets" json:"totalTickets"`
 }
 
 // CacheStats stores cache statistics for WiredTiger.
@@ -52,11 +67,20 @@ type CacheStats struct {
 	TrackedDirtyBytes  int64 `bson:"tracked dirty bytes in the cache" json:"tracked dirty bytes in the cache"`
 	CurrentCachedBytes int64 `bson:"bytes currently in the cache" json:"bytes currently in the cache"`
 	MaxBytesConfigured int64 `bson:"maximum bytes configured" json:"maximum bytes configured"`
+
+	BytesReadInto      int64 `bson:"bytes read into cache" json:"bytes read into cache"`
+	BytesWrittenFrom   int64 `bson:"bytes written from cache" json:"bytes written from cache"`
+	PagesReadInto      int64 `bson:"pages read into cache" json:"pages read into cache"`
+	PagesWrittenFrom   int64 `bson:"pages written from cache" json:"pages written from cache"`
+	AppEvictedPages    int64 `bson:"pages evicted by application threads" json:"pages evicted by application threads"`
+	WorkerEvictedPages int64 `bson:"eviction worker thread evicting pages" json:"eviction worker thread evicting pages"`
 }
 
 // TransactionStats stores transaction checkpoints in WiredTiger.
 type TransactionStats struct {
-	TransCheckpoints int64 `bson:"transaction checkpoints" json:"transaction checkpoints"`
+	TransCheckpoints       int64 `bson:"transaction checkpoints" json:"transaction checkpoints"`
+	CheckpointRunning      int64 `bson:"transaction checkpoint currently running" json:"transaction checkpoint currently running"`
+	CheckpointMostRecentMs int64 `bson:"transaction checkpoint most recent time (msecs)" json:"transaction checkpoint most recent time (msecs)"`
 }
 
 // ReplStatus stores data related to replica sets.
@@ -69,6 +93,135 @@ type ReplStatus struct {
 	Me        string   `bson:"me" json:"me"`
 }
 
+// ReplSetStatus stores the part of the replSetGetStatus output needed to
+// compute replication lag.
+type ReplSetStatus struct {
+	Members []ReplSetMember `bson:"members" json:"members"`
+}
+
+// ReplSetMember stores the optime of a single replica set member.
+type ReplSetMember struct {
+	Name       string    `bson:"name" json:"name"`
+	State      int       `bson:"state" json:"state"`
+	OptimeDate time.Time `bson:"optimeDate" json:"optimeDate"`
+	Self       bool      `bson:"self" json:"self"`
+}
+
+// ReplSetConfig stores the part of the replSetGetConfig output needed to
+// recognize intentionally delayed members.
+type ReplSetConfig struct {
+	Config struct {
+		Members []ReplSetConfigMember `bson:"members" json:"members"`
+	} `bson:"config" json:"config"`
+}
+
+// ReplSetConfigMember stores the configured delay of a replica set member.
+type ReplSetConfigMember struct {
+	Host       string `bson:"host" json:"host"`
+	SlaveDelay int64  `bson:"slaveDelay" json:"slaveDelay"`
+}
+
+// ReplLag stores how far a member is behind the primary's optime.
+type ReplLag struct {
+	Primary    bool          `json:"primary"`
+	Lag        time.Duration `json:"lag"`
+	SlaveDelay time.Duration `json:"slaveDelay"`
+}
+
+// memberStatePrimary is the replSetGetStatus state of a primary.
+const memberStatePrimary = 1
+
+// NewReplLag computes the lag of the member that ran replSetGetStatus. It
+// returns nil if the lag cannot be determined, e.g. there is no primary or
+// the member is an arbiter. The config is optional.
+func NewReplLag(rs *ReplSetStatus, conf *ReplSetConfig) *ReplLag {
+	var self, primary *ReplSetMember
+	for i := range rs.Members {
+		member := &rs.Members[i]
+		if member.Self {
+			self = member
+		}
+		if member.State == memberStatePrimary {
+			primary = member
+		}
+	}
+	if self == nil || primary == nil || self.OptimeDate.IsZero() {
+		return nil
+	}
+
+	lag := &ReplLag{
+		Primary: self == primary,
+		Lag:     primary.OptimeDate.Sub(self.OptimeDate),
+	}
+	if lag.Lag < 0 {
+		lag.Lag = 0
+	}
+	if conf != nil {
+		for _, member := range conf.Config.Members {
+			if member.Host == self.Name {
+				lag.SlaveDelay = time.Duration(member.SlaveDelay) * time.Second
+			}
+		}
+	}
+	return lag
+}
+
+// MetricsStats stores the metrics section of serverStatus.
+type MetricsStats struct {
+	Document      DocumentStats      `bson:"document" json:"document"`
+	Operation     OperationStats     `bson:"operation" json:"operation"`
+	QueryExecutor QueryExecutorStats `bson:"queryExecutor" json:"queryExecutor"`
+	Cursor        CursorStats        `bson:"cursor" json:"cursor"`
+	Repl          ReplMetricsStats   `bson:"repl" json:"repl"`
+}
+
+// DocumentStats stores the number of documents touched by CRUD operations.
+type DocumentStats struct {
+	Deleted  int64 `bson:"deleted" json:"deleted"`
+	Inserted int64 `bson:"inserted" json:"inserted"`
+	Returned int64 `bson:"returned" json:"returned"`
+	Updated  int64 `bson:"updated" json:"updated"`
+}
+
+// OperationStats stores counts of special cased update and query operations.
+type OperationStats struct {
+	Fastmod        int64 `bson:"fastmod" json:"fastmod"`
+	Idhack         int64 `bson:"idhack" json:"idhack"`
+	ScanAndOrder   int64 `bson:"scanAndOrder" json:"scanAndOrder"`
+	WriteConflicts int64 `bson:"writeConflicts" json:"writeConflicts"`
+}
+
+// QueryExecutorStats stores the number of index keys and documents scanned.
+type QueryExecutorStats struct {
+	Scanned        int64 `bson:"scanned" json:"scanned"`
+	ScannedObjects int64 `bson:"scannedObjects" json:"scannedObjects"`
+}
+
+// CursorStats stores information related to cursor state.
+type CursorStats struct {
+	TimedOut int64           `bson:"timedOut" json:"timedOut"`
+	Open     OpenCursorStats `bson:"open" json:"open"`
+}
+
+// OpenCursorStats stores the number of cursors currently open.
+type OpenCursorStats struct {
+	NoTimeout int64 `bson:"noTimeout" json:"noTimeout"`
+	Pinned    int64 `bson:"pinned" json:"pinned"`
+	Total     int64 `bson:"total" json:"total"`
+}
+
+// ReplMetricsStats stores the replication metrics.
+type ReplMetricsStats struct {
+	Buffer ReplBufferStats `bson:"buffer" json:"buffer"`
+}
+
+// ReplBufferStats stores the state of the oplog buffer of a secondary.
+type ReplBufferStats struct {
+	Count        int64 `bson:"count" json:"count"`
+	MaxSizeBytes int64 `bson:"maxSizeBytes" json:"maxSizeBytes"`
+	SizeBytes    int64 `bson:"sizeBytes" json:"sizeBytes"`
+}
+
 // DBRecordStats stores data related to memory operations across databases.
 type DBRecordStats struct {
 	AccessesNotInMemory       int64                     `bson:"accessesNotInMemory" json:"accessesNotInMemory"`
@@ -193,6 +346,22 @@ type ExtraInfo struct {
 	PageFaults *int64 `bson:"page_faults" json:"page_faults"`
 }
 
+// ErrRestarted is reported for a host whose counters can no longer be diffed
+// against the previous sample because the server restarted in between.
+var ErrRestarted = errors.New("host restarted")
+
+// ErrTimeout is reported for a host that did not answer within its poll deadline.
+var ErrTimeout = errors.New("timeout")
+
+// DefaultSkewThreshold is how far a host's clock may drift from the local
+// clock before mongostat warns about it.
+const DefaultSkewThreshold = time.Second
+
+// MinSampleInterval is the shortest time between two samples of a host for
+// which rates are computed. Closer samples are dropped rather than divided by
+// a near zero interval.
+const MinSampleInterval = 100 * time.Millisecond
+
 // NodeError pairs an error with a hostname
 type NodeError struct {
 	Host string
@@ -203,6 +372,23 @@ func (ne *NodeError) Error() string {
 	return ne.err.Error()
 }
 
+// Unwrap returns the error of the host, e.g. ErrTimeout.
+func (ne *NodeError) Unwrap() error {
+	return ne.err
+}
+
+// TimedOut reports whether the host did not answer within its poll deadline.
+func (ne *NodeError) TimedOut() bool {
+	return ne.err == ErrTimeout
+}
+
+// Restarted reports whether the error marks a restart of the host rather
+// than a failed poll. The host answered, but its sample became the baseline
+// for the next rates instead of being diffed.
+func (ne *NodeError) Restarted() bool {
+	return ne.err == ErrRestarted
+}
+
 func NewNodeError(host string, err error) *NodeError {
 	return &NodeError{
 		err:  err,
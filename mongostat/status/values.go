@@ -0,0 +1,520 @@
+package status
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xkeyideal/mongo-tools/common/util"
+)
+
+// A ValueReader returns the numbers behind a column before they are
+// formatted, e.g. the read and write queue lengths of qrw, or nil if the host
+// does not report them. Rates are per second and are not rounded.
+type ValueReader func(newStat, oldStat *ServerStatus) []float64
+
+// A ValueFormatter renders the numbers of a ValueReader the way the column
+// displays them.
+type ValueFormatter func(c *ReaderConfig, values []float64) string
+
+// rate computes the per second rate of a counter between two samples.
+func rate(newVal, oldVal int64, sampleSecs float64) float64 {
+	if sampleSecs <= 0 {
+		return 0
+	}
+	return float64(newVal-oldVal) / sampleSecs
+}
+
+func opValues(newStat, oldStat *ServerStatus, f func(*OpcountStats) int64) []float64 {
+	sampleSecs := sampleSeconds(newStat, oldStat)
+	var opcount, opcountRepl float64
+	if newStat.Opcounters != nil && oldStat.Opcounters != nil {
+		opcount = rate(f(newStat.Opcounters), f(oldStat.Opcounters), sampleSecs)
+	}
+	if newStat.OpcountersRepl != nil && oldStat.OpcountersRepl != nil {
+		opcountRepl = rate(f(newStat.OpcountersRepl), f(oldStat.OpcountersRepl), sampleSecs)
+	}
+	return []float64{opcount, opcountRepl}
+}
+
+// InsertValues returns the insert rates, of the host's own operations and
+// of the replicated ones.
+func InsertValues(newStat, oldStat *ServerStatus) []float64 {
+	return opValues(newStat, oldStat, func(o *OpcountStats) int64 {
+		return o.Insert
+	})
+}
+
+// QueryValues returns the query rates, own and replicated.
+func QueryValues(newStat, oldStat *ServerStatus) []float64 {
+	return opValues(newStat, oldStat, func(o *OpcountStats) int64 {
+		return o.Query
+	})
+}
+
+// UpdateValues returns the update rates, own and replicated.
+func UpdateValues(newStat, oldStat *ServerStatus) []float64 {
+	return opValues(newStat, oldStat, func(o *OpcountStats) int64 {
+		return o.Update
+	})
+}
+
+// DeleteValues returns the delete rates, own and replicated.
+func DeleteValues(newStat, oldStat *ServerStatus) []float64 {
+	return opValues(newStat, oldStat, func(o *OpcountStats) int64 {
+		return o.Delete
+	})
+}
+
+// CommandValues returns the command rates, own and replicated.
+func CommandValues(newStat, oldStat *ServerStatus) []float64 {
+	return opValues(newStat, oldStat, func(o *OpcountStats) int64 {
+		return o.Command
+	})
+}
+
+// GetMoreValues returns the getmore rate.
+func GetMoreValues(newStat, oldStat *ServerStatus) []float64 {
+	if newStat.Opcounters == nil || oldStat.Opcounters == nil {
+		return nil
+	}
+	sampleSecs := sampleSeconds(newStat, oldStat)
+	return []float64{rate(newStat.Opcounters.GetMore, oldStat.Opcounters.GetMore, sampleSecs)}
+}
+
+// metricsValues returns the per second rates of counters of the metrics
+// section, or nil if either sample is missing it.
+func metricsValues(newStat, oldStat *ServerStatus, fs ...func(*MetricsStats) int64) []float64 {
+	if newStat.Metrics == nil || oldStat.Metrics == nil {
+		return nil
+	}
+	sampleSecs := sampleSeconds(newStat, oldStat)
+	values := make([]float64, len(fs))
+	for i, f := range fs {
+		values[i] = rate(f(newStat.Metrics), f(oldStat.Metrics), sampleSecs)
+	}
+	return values
+}
+
+// ScannedValues returns the rates of index keys and documents scanned.
+func ScannedValues(newStat, oldStat *ServerStatus) []float64 {
+	return metricsValues(newStat, oldStat,
+		func(m *MetricsStats) int64 { return m.QueryExecutor.Scanned },
+		func(m *MetricsStats) int64 { return m.QueryExecutor.ScannedObjects })
+}
+
+// ReturnedValues returns the rate of documents returned.
+func ReturnedValues(newStat, oldStat *ServerStatus) []float64 {
+	return metricsValues(newStat, oldStat,
+		func(m *MetricsStats) int64 { return m.Document.Returned })
+}
+
+// CursorsValues returns the number of open cursors, and of the cursors that
+// timed out since the previous sample.
+func CursorsValues(newStat, oldStat *ServerStatus) []float64 {
+	if newStat.Metrics == nil || oldStat.Metrics == nil {
+		return nil
+	}
+	timedOut := newStat.Metrics.Cursor.TimedOut - oldStat.Metrics.Cursor.TimedOut
+	return []float64{float64(newStat.Metrics.Cursor.Open.Total), float64(timedOut)}
+}
+
+func cachePercentage(stat *ServerStatus, bytes func(*WiredTiger) int64) []float64 {
+	if stat.WiredTiger == nil || stat.WiredTiger.Cache.MaxBytesConfigured == 0 {
+		return nil
+	}
+	max := float64(stat.WiredTiger.Cache.MaxBytesConfigured)
+	return []float64{100 * float64(bytes(stat.WiredTiger)) / max}
+}
+
+// DirtyValues returns the percentage of the WiredTiger cache that is dirty.
+func DirtyValues(newStat, _ *ServerStatus) []float64 {
+	return cachePercentage(newStat, func(wt *WiredTiger) int64 {
+		return wt.Cache.TrackedDirtyBytes
+	})
+}
+
+// UsedValues returns the percentage of the WiredTiger cache in use.
+func UsedValues(newStat, _ *ServerStatus) []float64 {
+	return cachePercentage(newStat, func(wt *WiredTiger) int64 {
+		return wt.Cache.CurrentCachedBytes
+	})
+}
+
+// FlushesValues returns the number of checkpoints, or of MMAPv1 flushes,
+// since the previous sample.
+func FlushesValues(newStat, oldStat *ServerStatus) []float64 {
+	var val int64
+	if newStat.WiredTiger != nil && oldStat.WiredTiger != nil {
+		val = newStat.WiredTiger.Transaction.TransCheckpoints - oldStat.WiredTiger.Transaction.TransCheckpoints
+	} else if newStat.BackgroundFlushing != nil && oldStat.BackgroundFlushing != nil {
+		val = newStat.BackgroundFlushing.Flushes - oldStat.BackgroundFlushing.Flushes
+	}
+	return []float64{float64(val)}
+}
+
+func memValues(stat *ServerStatus, ok bool, megabytes int64) []float64 {
+	if stat.Mem == nil || !util.IsTruthy(stat.Mem.Supported) || !ok {
+		return nil
+	}
+	return []float64{float64(megabytes)}
+}
+
+// MappedValues returns the mapped memory in megabytes.
+func MappedValues(newStat, _ *ServerStatus) []float64 {
+	if newStat.Mem == nil {
+		return nil
+	}
+	return memValues(newStat, IsMongos(newStat), newStat.Mem.Mapped)
+}
+
+// VSizeValues returns the virtual memory in megabytes.
+func VSizeValues(newStat, _ *ServerStatus) []float64 {
+	if newStat.Mem == nil {
+		return nil
+	}
+	return memValues(newStat, true, newStat.Mem.Virtual)
+}
+
+// ResValues returns the resident memory in megabytes.
+func ResValues(newStat, _ *ServerStatus) []float64 {
+	if newStat.Mem == nil {
+		return nil
+	}
+	return memValues(newStat, true, newStat.Mem.Resident)
+}
+
+// NonMappedValues returns the virtual memory that is not mapped in megabytes.
+func NonMappedValues(newStat, _ *ServerStatus) []float64 {
+	if newStat.Mem == nil {
+		return nil
+	}
+	return memValues(newStat, !IsMongos(newStat), newStat.Mem.Virtual-newStat.Mem.Mapped)
+}
+
+// FaultsValues returns the page fault rate of an MMAPv1 host.
+func FaultsValues(newStat, oldStat *ServerStatus) []float64 {
+	if !IsMMAP(newStat) || oldStat.ExtraInfo == nil || newStat.ExtraInfo == nil ||
+		oldStat.ExtraInfo.PageFaults == nil || newStat.ExtraInfo.PageFaults == nil {
+		return nil
+	}
+	sampleSecs := sampleSeconds(newStat, oldStat)
+	return []float64{rate(*newStat.ExtraInfo.PageFaults, *oldStat.ExtraInfo.PageFaults, sampleSecs)}
+}
+
+// collectionLocks returns the Collection locks of both samples of a 3.0+
+// host, or false if they cannot be diffed.
+func collectionLocks(newStat, oldStat *ServerStatus) (newColl, oldColl LockStats, ok bool) {
+	if IsMongos(newStat) || newStat.Locks == nil || oldStat.Locks == nil {
+		return
+	}
+	if global, inOld := oldStat.Locks["Global"]; !inOld || global.AcquireCount == nil {
+		return
+	}
+	newColl, inNew := newStat.Locks["Collection"]
+	oldColl, inOld := oldStat.Locks["Collection"]
+	ok = inNew && inOld &&
+		newColl.AcquireCount != nil && oldColl.AcquireCount != nil &&
+		newColl.AcquireWaitCount != nil && oldColl.AcquireWaitCount != nil
+	return
+}
+
+// LRWValues returns the percentages of the read and write acquisitions of
+// the collection locks that had to wait.
+func LRWValues(newStat, oldStat *ServerStatus) []float64 {
+	newColl, oldColl, ok := collectionLocks(newStat, oldStat)
+	if !ok {
+		return nil
+	}
+	rWait := newColl.AcquireWaitCount.Read - oldColl.AcquireWaitCount.Read
+	wWait := newColl.AcquireWaitCount.Write - oldColl.AcquireWaitCount.Write
+	rTotal := newColl.AcquireCount.Read - oldColl.AcquireCount.Read
+	wTotal := newColl.AcquireCount.Write - oldColl.AcquireCount.Write
+	return []float64{percentageInt64(rWait, rTotal), percentageInt64(wWait, wTotal)}
+}
+
+// LRWTValues returns the average microseconds the read and write
+// acquisitions of the collection locks waited.
+func LRWTValues(newStat, oldStat *ServerStatus) []float64 {
+	newColl, oldColl, ok := collectionLocks(newStat, oldStat)
+	if !ok {
+		return nil
+	}
+	rWait := newColl.AcquireWaitCount.Read - oldColl.AcquireWaitCount.Read
+	wWait := newColl.AcquireWaitCount.Write - oldColl.AcquireWaitCount.Write
+	rAcquire := newColl.TimeAcquiringMicros.Read - oldColl.TimeAcquiringMicros.Read
+	wAcquire := newColl.TimeAcquiringMicros.Write - oldColl.TimeAcquiringMicros.Write
+	return []float64{float64(averageInt64(rAcquire, rWait)), float64(averageInt64(wAcquire, wWait))}
+}
+
+// QRWValues returns the number of queued reads and writes.
+func QRWValues(newStat, _ *ServerStatus) []float64 {
+	var qr, qw int64
+	gl := newStat.GlobalLock
+	if gl != nil && gl.CurrentQueue != nil {
+		// If we have wiredtiger stats, use those instead
+		if newStat.WiredTiger != nil && gl.ActiveClients != nil {
+			qr = gl.CurrentQueue.Readers + gl.ActiveClients.Readers - newStat.WiredTiger.Concurrent.Read.Out
+			qw = gl.CurrentQueue.Writers + gl.ActiveClients.Writers - newStat.WiredTiger.Concurrent.Write.Out
+			if qr < 0 {
+				qr = 0
+			}
+			if qw < 0 {
+				qw = 0
+			}
+		} else {
+			qr = gl.CurrentQueue.Readers
+			qw = gl.CurrentQueue.Writers
+		}
+	}
+	return []float64{float64(qr), float64(qw)}
+}
+
+// ARWValues returns the number of active reads and writes.
+func ARWValues(newStat, _ *ServerStatus) []float64 {
+	var ar, aw int64
+	if gl := newStat.GlobalLock; gl != nil {
+		if newStat.WiredTiger != nil {
+			ar = newStat.WiredTiger.Concurrent.Read.Out
+			aw = newStat.WiredTiger.Concurrent.Write.Out
+		} else if gl.ActiveClients != nil {
+			ar = gl.ActiveClients.Readers
+			aw = gl.ActiveClients.Writers
+		}
+	}
+	return []float64{float64(ar), float64(aw)}
+}
+
+// TRWValues returns the available WiredTiger read and write tickets.
+func TRWValues(newStat, _ *ServerStatus) []float64 {
+	wt := newStat.WiredTiger
+	if wt == nil {
+		return nil
+	}
+	return []float64{float64(wt.Concurrent.Read.Available), float64(wt.Concurrent.Write.Available)}
+}
+
+// wtValues returns the per second rates of WiredTiger counters, or nil if
+// either sample is missing the wiredTiger section.
+func wtValues(newStat, oldStat *ServerStatus, fs ...func(*WiredTiger) int64) []float64 {
+	if newStat.WiredTiger == nil || oldStat.WiredTiger == nil {
+		return nil
+	}
+	sampleSecs := sampleSeconds(newStat, oldStat)
+	values := make([]float64, len(fs))
+	for i, f := range fs {
+		values[i] = rate(f(newStat.WiredTiger), f(oldStat.WiredTiger), sampleSecs)
+	}
+	return values
+}
+
+// EvictValues returns the rates of pages evicted by application and by
+// worker threads.
+func EvictValues(newStat, oldStat *ServerStatus) []float64 {
+	return wtValues(newStat, oldStat,
+		func(wt *WiredTiger) int64 { return wt.Cache.AppEvictedPages },
+		func(wt *WiredTiger) int64 { return wt.Cache.WorkerEvictedPages })
+}
+
+// PagesRWValues returns the rates of pages read into and written from the
+// cache.
+func PagesRWValues(newStat, oldStat *ServerStatus) []float64 {
+	return wtValues(newStat, oldStat,
+		func(wt *WiredTiger) int64 { return wt.Cache.PagesReadInto },
+		func(wt *WiredTiger) int64 { return wt.Cache.PagesWrittenFrom })
+}
+
+// CheckpointValues returns whether a checkpoint is running, 1 or 0, and the
+// duration of the most recent one in milliseconds.
+func CheckpointValues(newStat, _ *ServerStatus) []float64 {
+	wt := newStat.WiredTiger
+	if wt == nil {
+		return nil
+	}
+	return []float64{float64(wt.Transaction.CheckpointRunning), float64(wt.Transaction.CheckpointMostRecentMs)}
+}
+
+// CacheInValues returns the rate of bytes read into the cache.
+func CacheInValues(newStat, oldStat *ServerStatus) []float64 {
+	return wtValues(newStat, oldStat,
+		func(wt *WiredTiger) int64 { return wt.Cache.BytesReadInto })
+}
+
+// NetInValues returns the rate of bytes received.
+func NetInValues(newStat, oldStat *ServerStatus) []float64 {
+	if newStat.Network == nil || oldStat.Network == nil {
+		return nil
+	}
+	sampleSecs := sampleSeconds(newStat, oldStat)
+	return []float64{rate(newStat.Network.BytesIn, oldStat.Network.BytesIn, sampleSecs)}
+}
+
+// NetOutValues returns the rate of bytes sent.
+func NetOutValues(newStat, oldStat *ServerStatus) []float64 {
+	if newStat.Network == nil || oldStat.Network == nil {
+		return nil
+	}
+	sampleSecs := sampleSeconds(newStat, oldStat)
+	return []float64{rate(newStat.Network.BytesOut, oldStat.Network.BytesOut, sampleSecs)}
+}
+
+// ConnValues returns the number of open connections.
+func ConnValues(newStat, _ *ServerStatus) []float64 {
+	if newStat.Connections == nil {
+		return nil
+	}
+	return []float64{float64(newStat.Connections.Current)}
+}
+
+// LagValues returns the replication lag in seconds, not counting any
+// configured slaveDelay, and the slaveDelay.
+func LagValues(newStat, _ *ServerStatus) []float64 {
+	if newStat.ReplLag == nil {
+		return nil
+	}
+	lag := newStat.ReplLag.Lag - newStat.ReplLag.SlaveDelay
+	if lag < 0 {
+		lag = 0
+	}
+	return []float64{lag.Seconds(), newStat.ReplLag.SlaveDelay.Seconds()}
+}
+
+// RTTValues returns the round trip time of the serverStatus call in
+// milliseconds.
+func RTTValues(newStat, _ *ServerStatus) []float64 {
+	return []float64{milliseconds(newStat.RTT)}
+}
+
+// SkewValues returns how far the host's clock is ahead of the local clock in
+// milliseconds.
+func SkewValues(newStat, _ *ServerStatus) []float64 {
+	if newStat.LocalTime.IsZero() {
+		return nil
+	}
+	return []float64{milliseconds(newStat.Skew)}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// FormatValues formats the values with format, or returns "" if there are
+// none.
+func FormatValues(c *ReaderConfig, format ValueFormatter, values []float64) string {
+	if values == nil {
+		return ""
+	}
+	return format(c, values)
+}
+
+// FormatCounts formats whole numbers, separated by '|'.
+func FormatCounts(_ *ReaderConfig, values []float64) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%d", int64(v))
+	}
+	return strings.Join(parts, "|")
+}
+
+// FormatOps formats the own and replicated rates of an opcounter as
+// "ops|repl", "ops" or "*repl" depending on which of the two were active.
+func FormatOps(_ *ReaderConfig, values []float64) string {
+	return formatOps(values, false)
+}
+
+// FormatCommandOps is FormatOps, but always shows both rates.
+func FormatCommandOps(_ *ReaderConfig, values []float64) string {
+	return formatOps(values, true)
+}
+
+func formatOps(values []float64, both bool) string {
+	opcount, opcountRepl := int64(values[0]), int64(values[1])
+	switch {
+	case both || opcount > 0 && opcountRepl > 0:
+		return fmt.Sprintf("%v|%v", opcount, opcountRepl)
+	case opcount > 0:
+		return fmt.Sprintf("%v", opcount)
+	case opcountRepl > 0:
+		return fmt.Sprintf("*%v", opcountRepl)
+	default:
+		return "*0"
+	}
+}
+
+// FormatPercentage formats a percentage with a '%' for human readable output.
+func FormatPercentage(c *ReaderConfig, values []float64) string {
+	val := fmt.Sprintf("%.1f", values[0])
+	if c.HumanReadable {
+		val = val + "%"
+	}
+	return val
+}
+
+// FormatPercentages formats percentages, separated by '|'.
+func FormatPercentages(_ *ReaderConfig, values []float64) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%.1f%%", v)
+	}
+	return strings.Join(parts, "|")
+}
+
+// FormatMegabytes formats an amount of megabytes.
+func FormatMegabytes(c *ReaderConfig, values []float64) string {
+	return formatMegabyteAmount(c.HumanReadable, int64(values[0]))
+}
+
+// FormatBytes formats an amount of bytes.
+func FormatBytes(c *ReaderConfig, values []float64) string {
+	return formatBytes(c.HumanReadable, int64(values[0]))
+}
+
+// FormatBits formats an amount of network traffic.
+func FormatBits(c *ReaderConfig, values []float64) string {
+	return formatBits(c.HumanReadable, int64(values[0]))
+}
+
+// FormatCheckpoint formats whether a checkpoint is running and the duration
+// of the most recent one.
+func FormatCheckpoint(c *ReaderConfig, values []float64) string {
+	val := FormatCounts(c, values)
+	if c.HumanReadable {
+		val = val + "ms"
+	}
+	return val
+}
+
+// FormatLag formats the values of LagValues, marking delayed members with
+// a '*'.
+func FormatLag(c *ReaderConfig, values []float64) string {
+	val := fmt.Sprintf("%d", int64(values[0]))
+	if c.HumanReadable {
+		val = val + "s"
+	}
+	if len(values) > 1 && values[1] > 0 {
+		val = val + "*"
+	}
+	return val
+}
+
+// FormatRTT formats a round trip time in milliseconds.
+func FormatRTT(c *ReaderConfig, values []float64) string {
+	val := fmt.Sprintf("%d", int64(values[0]))
+	if c.HumanReadable {
+		val = val + "ms"
+	}
+	return val
+}
+
+// FormatSkew formats a clock skew in milliseconds, marked with a '!' once it
+// drifts past the threshold.
+func FormatSkew(c *ReaderConfig, values []float64) string {
+	val := fmt.Sprintf("%+d", int64(values[0]))
+	if c.HumanReadable {
+		val = val + "ms"
+	}
+	if skewDrifted(c, time.Duration(values[0]*float64(time.Millisecond))) {
+		val = val + "!"
+	}
+	return val
+}
@@ -0,0 +1,204 @@
+package mongostat
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xkeyideal/mongo-tools/mongostat/stat_consumer"
+	"github.com/xkeyideal/mongo-tools/mongostat/stat_consumer/line"
+)
+
+// Subscription receives its own copy of the output of a MongoStat, rendered
+// with its own LineFormatter into its own bounded buffer.
+type Subscription struct {
+	// atomic operations are performed on dropped, so it should stay at the
+	// beginning for the sake of variable alignment
+	dropped int64
+
+	formatter stat_consumer.LineFormatter
+	messages  chan string
+}
+
+// Messages returns the channel the subscription's output is delivered on.
+// It is closed when the subscription ends.
+func (sub *Subscription) Messages() <-chan string {
+	return sub.messages
+}
+
+// Message blocks until the next output is available, like MongoStat's
+// Message. It returns false once the subscription has ended.
+func (sub *Subscription) Message() (string, bool) {
+	msg, ok := <-sub.messages
+	return msg, ok
+}
+
+// Dropped returns how many outputs were discarded because the subscriber did
+// not keep up and its buffer was full.
+func (sub *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&sub.dropped)
+}
+
+// deliver formats the lines for the subscriber without ever blocking the
+// monitor. It returns true if the formatter does not accept any more lines.
+func (sub *Subscription) deliver(lines []*line.StatLine, headerKeys []string, keyNames map[string]string) bool {
+	str := sub.formatter.FormatLines(lines, headerKeys, keyNames)
+	select {
+	case sub.messages <- str:
+	default:
+		atomic.AddInt64(&sub.dropped, 1)
+	}
+	return sub.formatter.IsFinished()
+}
+
+// Subscriptions fans the StatLines of a cluster monitor out to every
+// Subscription, so that the nodes are polled only once however many
+// consumers there are.
+type Subscriptions struct {
+	// atomic operations are performed on storageDropped, so it should stay
+	// at the beginning for the sake of variable alignment
+	storageDropped int64
+
+	lock   sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+
+	// storageFinished is set once the monitor's own formatter accepts no
+	// more lines, after which the storage channel is closed while the
+	// subscribers carry on. Only accessed by the monitor's goroutine.
+	storageFinished bool
+	storageClosed   bool
+}
+
+func newSubscriptions() *Subscriptions {
+	return &Subscriptions{
+		subs: map[*Subscription]struct{}{},
+	}
+}
+
+// add registers a new subscriber. Subscribing after the monitor finished
+// yields a subscription that is already closed.
+func (subs *Subscriptions) add(formatter stat_consumer.LineFormatter, buffer int) (*Subscription, error) {
+	if buffer < 1 {
+		// output is never waited for, so an unbuffered subscriber would miss
+		// nearly all of it
+		return nil, fmt.Errorf("a subscription needs a buffer of at least 1, not %v", buffer)
+	}
+	sub := &Subscription{
+		formatter: formatter,
+		messages:  make(chan string, buffer),
+	}
+
+	subs.lock.Lock()
+	defer subs.lock.Unlock()
+	if subs.closed {
+		close(sub.messages)
+		return sub, nil
+	}
+	subs.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// StorageDropped returns how many outputs of the monitor's own storage
+// channel were discarded because it was full while there were subscribers.
+func (subs *Subscriptions) StorageDropped() int64 {
+	return atomic.LoadInt64(&subs.storageDropped)
+}
+
+// closeStorage closes the monitor's storage channel, once, and marks it
+// closed in the monitor's StorageClosed.
+func (subs *Subscriptions) closeStorage(storage chan string, storageClosed *int32) {
+	if !subs.storageClosed {
+		subs.storageClosed = true
+		atomic.StoreInt32(storageClosed, ChannelClosed)
+		close(storage)
+	}
+}
+
+// remove ends the subscription and closes its channel.
+func (subs *Subscriptions) remove(sub *Subscription) {
+	subs.lock.Lock()
+	defer subs.lock.Unlock()
+	if _, ok := subs.subs[sub]; ok {
+		delete(subs.subs, sub)
+		close(sub.messages)
+	}
+}
+
+// closeAll ends every subscription, once the monitor is done.
+func (subs *Subscriptions) closeAll() {
+	subs.lock.Lock()
+	defer subs.lock.Unlock()
+	for sub := range subs.subs {
+		close(sub.messages)
+	}
+	subs.subs = map[*Subscription]struct{}{}
+	subs.closed = true
+}
+
+// publish formats the lines for every subscriber and for the monitor's own
+// storage channel, returning whether the monitor is finished: once its own
+// formatter and those of every subscriber accept no more lines. When its own
+// formatter finishes first, the storage channel is closed and the
+// subscribers carry on.
+//
+// Without subscribers the storage channel blocks as it always has. Once
+// there are subscribers nothing may stall the others, so output that does not
+// fit in the storage channel is dropped, and counted, like it is for
+// subscribers. Once done is closed the monitor is shutting down, and output
+// nobody reads is dropped.
+func (subs *Subscriptions) publish(done <-chan struct{}, consumer *stat_consumer.StatConsumer, storage chan string, storageClosed *int32, lines []*line.StatLine) bool {
+	headerKeys := consumer.Headers()
+	keyNames := consumer.KeyNames()
+
+	subs.lock.RLock()
+	subscribed := len(subs.subs) > 0
+	var finished []*Subscription
+	for sub := range subs.subs {
+		// Formatters mark lines as printed, so each one gets its own copies.
+		if sub.deliver(copyLines(lines), headerKeys, keyNames) {
+			finished = append(finished, sub)
+		}
+	}
+	subs.lock.RUnlock()
+
+	for _, sub := range finished {
+		subs.remove(sub)
+	}
+
+	if !subs.storageFinished {
+		str, finish := consumer.FormatLines(lines)
+		if !subscribed {
+			select {
+			case storage <- str:
+			case <-done:
+			}
+		} else {
+			select {
+			case storage <- str:
+			default:
+				atomic.AddInt64(&subs.storageDropped, 1)
+			}
+		}
+		if finish {
+			subs.storageFinished = true
+			subs.closeStorage(storage, storageClosed)
+		}
+	}
+
+	if !subs.storageFinished {
+		return false
+	}
+	subs.lock.RLock()
+	defer subs.lock.RUnlock()
+	return len(subs.subs) == 0
+}
+
+func copyLines(lines []*line.StatLine) []*line.StatLine {
+	copies := make([]*line.StatLine, len(lines))
+	for i, l := range lines {
+		c := *l
+		copies[i] = &c
+	}
+	return copies
+}
@@ -0,0 +1,442 @@
+package mongotop
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xkeyideal/mongo-tools/common/db"
+	"github.com/xkeyideal/mongo-tools/common/options"
+	"github.com/xkeyideal/mongo-tools/common/util"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ClusterTopDiff is the TopDiff of several hosts, summed per namespace.
+// The TopDiff of each host is kept alongside for the per host breakdown.
+type ClusterTopDiff struct {
+	TopDiff
+
+	// host -> diff of that host
+	Hosts map[string]TopDiff `json:"hosts"`
+
+	// host -> error, for the hosts that could not be polled this time
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// clusterTotalHost is the host of the rows summing all the hosts.
+const clusterTotalHost = "TOTAL"
+
+// errTimeout is reported for a host that did not answer top within the
+// polling interval.
+var errTimeout = errors.New("timeout")
+
+// topNode holds the connection to, and the previous sample of, one host
+// of a cluster mode MongoTop.
+type topNode struct {
+	// Set while a poll is in flight, so that a hung host is not polled
+	// again. Accessed atomically, so it stays first for alignment.
+	polling int32
+
+	host            string
+	sessionProvider *db.SessionProvider
+	previousTop     *Top
+}
+
+// isMasterResult holds the fields of the "isMaster" command used to find
+// the hosts to run top on.
+type isMasterResult struct {
+	SetName  string   `bson:"setName"`
+	Hosts    []string `bson:"hosts"`
+	Passives []string `bson:"passives"`
+	Primary  string   `bson:"primary"`
+	Msg      string   `bson:"msg"`
+}
+
+// shardDoc holds a mapping for the format of shard hosts as they
+// appear in the config.shards collection.
+type shardDoc struct {
+	Id   string `bson:"_id"`
+	Host string `bson:"host"`
+}
+
+// NewMongoTopCluster creates a MongoTop that runs top on every one of hosts
+// and sums the deltas of each namespace across them. The hosts are connected
+// to directly, with the credentials in opts. Cluster mode reports top only,
+// lock reporting is per server.
+func NewMongoTopCluster(ctx context.Context, opts *options.ToolOptions, oopts *Output, hosts []string,
+	st time.Duration, during int64) (*MongoTop, error) {
+
+	if oopts.Locks {
+		return nil, fmt.Errorf("lock reporting is not supported across multiple hosts")
+	}
+	if err := oopts.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := NewDiffFormatter(oopts); err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts to run top on")
+	}
+
+	top := NewMongoTop(ctx, opts, oopts, nil, st, during)
+	top.filter, _ = NewNamespaceFilter(oopts.Include, oopts.Exclude)
+	for _, host := range hosts {
+		sp, err := newHostSessionProvider(opts, host)
+		if err != nil {
+			top.closeNodes()
+			top.cancel()
+			return nil, fmt.Errorf("error connecting to %v: %v", host, err)
+		}
+		top.nodes = append(top.nodes, &topNode{
+			host:            host,
+			sessionProvider: sp,
+		})
+	}
+	return top, nil
+}
+
+// DiscoverTopHosts returns the hosts a cluster mode MongoTop should poll for
+// the deployment opts connects to: the primary of every shard behind a mongos,
+// or the primary of a replica set. With members, every data bearing member of
+// the shards or the set is returned instead. A standalone is returned as is.
+func DiscoverTopHosts(opts *options.ToolOptions, members bool) ([]string, error) {
+	sp, err := db.NewSessionProvider(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer sp.Close()
+
+	session, err := sp.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	result := isMasterResult{}
+	err = session.Run("isMaster", &result)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case result.Msg == "isdbgrid":
+		shards := []shardDoc{}
+		err = session.DB("config").C("shards").Find(nil).All(&shards)
+		if err != nil {
+			return nil, err
+		}
+		hosts := []string{}
+		for _, shard := range shards {
+			seeds, _ := util.ParseConnectionString(shard.Host)
+			shardHosts, err := discoverSetHosts(opts, seeds, members)
+			if err != nil {
+				return nil, fmt.Errorf("error discovering shard %v: %v", shard.Id, err)
+			}
+			hosts = append(hosts, shardHosts...)
+		}
+		return hosts, nil
+	case result.SetName != "":
+		return setHosts(result, members)
+	default:
+		return opts.Addrs, nil
+	}
+}
+
+// discoverSetHosts asks the seeds of a replica set for its members, until one
+// of them answers.
+func discoverSetHosts(opts *options.ToolOptions, seeds []string, members bool) ([]string, error) {
+	err := fmt.Errorf("no hosts")
+	for _, seed := range seeds {
+		var sp *db.SessionProvider
+		sp, err = newHostSessionProvider(opts, seed)
+		if err != nil {
+			continue
+		}
+		result := isMasterResult{}
+		err = runOnProvider(sp, "isMaster", &result)
+		sp.Close()
+		if err != nil {
+			continue
+		}
+		return setHosts(result, members)
+	}
+	return nil, err
+}
+
+// setHosts returns the primary, or with members all data bearing members,
+// of the replica set described by result.
+func setHosts(result isMasterResult, members bool) ([]string, error) {
+	if members {
+		return append(result.Hosts, result.Passives...), nil
+	}
+	if result.Primary == "" {
+		return nil, fmt.Errorf("replica set %v has no primary", result.SetName)
+	}
+	return []string{result.Primary}, nil
+}
+
+// newHostSessionProvider copies the connection settings of opts, but
+// connects directly to host.
+func newHostSessionProvider(opts *options.ToolOptions, host string) (*db.SessionProvider, error) {
+	optsCopy := options.New(opts.AppName)
+
+	optsCopy.Source = opts.Source
+	optsCopy.Username = opts.Username
+	optsCopy.Password = opts.Password
+	optsCopy.Timeout = opts.Timeout
+	optsCopy.TCPKeepAliveSeconds = opts.TCPKeepAliveSeconds
+
+	optsCopy.Addrs = []string{host}
+	optsCopy.Direct = true
+	return db.NewSessionProvider(optsCopy)
+}
+
+func runOnProvider(sp *db.SessionProvider, cmd interface{}, result interface{}) error {
+	session, err := sp.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return session.DB("admin").Run(cmd, result)
+}
+
+// poll runs top on the host and returns its diff against the previous
+// sample, or nil for the first sample. The socket timeout bounds a hung
+// host by timeout.
+func (node *topNode) poll(filter *NamespaceFilter, timeout time.Duration) (*TopDiff, error) {
+	session, err := node.sessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(timeout)
+
+	var currentTop Top
+	err = session.DB("admin").Run(bson.D{{"top", 1}}, &currentTop)
+	if err != nil {
+		node.previousTop = nil
+		return nil, err
+	}
+	currentTop.sampleTime = time.Now()
+
+	var diff *TopDiff
+	if node.previousTop != nil {
+		topDiff := currentTop.Diff(*node.previousTop, filter)
+		diff = &topDiff
+	}
+	node.previousTop = &currentTop
+	return diff, nil
+}
+
+// pollWithDeadline runs poll, but gives up with errTimeout once timeout has
+// passed, so that one hung host does not hold up the others. The hung poll
+// is left to finish in the background, tracked by group, and until it does
+// the host keeps timing out.
+func (node *topNode) pollWithDeadline(filter *NamespaceFilter, timeout time.Duration, group *sync.WaitGroup) (*TopDiff, error) {
+	if !atomic.CompareAndSwapInt32(&node.polling, 0, 1) {
+		return nil, errTimeout
+	}
+
+	type pollResult struct {
+		diff *TopDiff
+		err  error
+	}
+	done := make(chan pollResult, 1)
+	group.Add(1)
+	go func() {
+		defer group.Done()
+		defer atomic.StoreInt32(&node.polling, 0)
+		diff, err := node.poll(filter, timeout)
+		done <- pollResult{diff, err}
+	}()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	select {
+	case res := <-done:
+		return res.diff, res.err
+	case <-deadline.C:
+		return nil, errTimeout
+	}
+}
+
+// runClusterDiff polls every host at once and sums their diffs. A host that
+// does not answer within Sleeptime is reported among the Errors, as are the
+// hosts whose poll failed. It only fails if none of the hosts could be polled.
+func (mt *MongoTop) runClusterDiff() (FormattableDiff, error) {
+	diff := ClusterTopDiff{
+		TopDiff: TopDiff{
+			Totals: map[string]NSTopInfo{},
+			Time:   time.Now(),
+			output: mt.OutputOptions,
+		},
+		Hosts:  map[string]TopDiff{},
+		Errors: map[string]string{},
+	}
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	for _, node := range mt.nodes {
+		wg.Add(1)
+		go func(node *topNode) {
+			defer wg.Done()
+			hostDiff, err := node.pollWithDeadline(mt.filter, mt.Sleeptime, &mt.running)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				diff.Errors[node.host] = err.Error()
+			} else if hostDiff != nil {
+				hostDiff.output = mt.OutputOptions
+				diff.Hosts[node.host] = *hostDiff
+			}
+		}(node)
+	}
+	wg.Wait()
+
+	if len(diff.Errors) == len(mt.nodes) {
+		errs := make([]string, 0, len(diff.Errors))
+		for host, err := range diff.Errors {
+			errs = append(errs, fmt.Sprintf("%v: %v", host, err))
+		}
+		sort.Strings(errs)
+		return nil, fmt.Errorf("top failed on every host: %v", strings.Join(errs, "; "))
+	}
+	if len(diff.Hosts) == 0 {
+		return nil, nil
+	}
+
+	created, reset, dropped := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, hostDiff := range diff.Hosts {
+		for ns, info := range hostDiff.Totals {
+			diff.Totals[ns] = diff.Totals[ns].add(info)
+		}
+		if hostDiff.IntervalMicros > diff.IntervalMicros {
+			diff.IntervalMicros = hostDiff.IntervalMicros
+		}
+		for _, ns := range hostDiff.Created {
+			created[ns] = true
+		}
+		for _, ns := range hostDiff.Reset {
+			reset[ns] = true
+		}
+		for _, ns := range hostDiff.Dropped {
+			dropped[ns] = true
+		}
+	}
+	// a namespace only counts as dropped once no host reports it any more
+	for ns := range diff.Totals {
+		delete(dropped, ns)
+	}
+	diff.Created = sortedNamespaces(created)
+	diff.Reset = sortedNamespaces(reset)
+	diff.Dropped = sortedNamespaces(dropped)
+	return diff, nil
+}
+
+func sortedNamespaces(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	namespaces := make([]string, 0, len(set))
+	for ns := range set {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// closeNodes releases the connections of a cluster mode MongoTop.
+func (mt *MongoTop) closeNodes() {
+	for _, node := range mt.nodes {
+		node.sessionProvider.Close()
+	}
+}
+
+// add returns the sum of two NSTopInfos.
+func (info NSTopInfo) add(other NSTopInfo) NSTopInfo {
+	return NSTopInfo{
+		Total:   info.Total.add(other.Total),
+		Read:    info.Read.add(other.Read),
+		Write:   info.Write.add(other.Write),
+		Query:   info.Query.add(other.Query),
+		Getmore: info.Getmore.add(other.Getmore),
+		Insert:  info.Insert.add(other.Insert),
+		Update:  info.Update.add(other.Update),
+		Remove:  info.Remove.add(other.Remove),
+		Command: info.Command.add(other.Command),
+	}
+}
+
+func (field TopField) add(other TopField) TopField {
+	return TopField{
+		Time:       field.Time + other.Time,
+		TimeMicros: field.TimeMicros + other.TimeMicros,
+		Count:      field.Count + other.Count,
+	}
+}
+
+// sortedKeys returns the hosts of a ClusterTopDiff in order, for output
+// that is stable between samples.
+func sortedKeys(m map[string]TopDiff) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Grid returns the summed diff as a table, followed by the table of each
+// host and the hosts that could not be polled.
+func (cd ClusterTopDiff) Grid() string {
+	buf := &bytes.Buffer{}
+	buf.WriteString(cd.TopDiff.Grid())
+
+	for _, host := range sortedKeys(cd.Hosts) {
+		fmt.Fprintf(buf, "\n%v\n", host)
+		buf.WriteString(cd.Hosts[host].Grid())
+	}
+
+	errHosts := make([]string, 0, len(cd.Errors))
+	for host := range cd.Errors {
+		errHosts = append(errHosts, host)
+	}
+	sort.Strings(errHosts)
+	for _, host := range errHosts {
+		fmt.Fprintf(buf, "\n%v  %v\n", host, cd.Errors[host])
+	}
+	return buf.String()
+}
+
+// JSON returns a JSON representation of the ClusterTopDiff.
+func (cd ClusterTopDiff) JSON() string {
+	return marshalDiff(cd)
+}
+
+// table returns the rows of the summed diff, with TOTAL as their host,
+// followed by the rows of each host.
+func (cd ClusterTopDiff) table() ([]string, [][]string) {
+	header, totalRows := cd.TopDiff.table()
+	header = append([]string{"host"}, header...)
+
+	rows := [][]string{}
+	for _, row := range totalRows {
+		rows = append(rows, append([]string{clusterTotalHost}, row...))
+	}
+	for _, host := range sortedKeys(cd.Hosts) {
+		_, hostRows := cd.Hosts[host].table()
+		for _, row := range hostRows {
+			rows = append(rows, append([]string{host}, row...))
+		}
+	}
+	return header, rows
+}
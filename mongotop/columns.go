@@ -0,0 +1,228 @@
+package mongotop
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultGridLimit is the number of namespaces Grid prints unless
+// Output.Limit says otherwise.
+const defaultGridLimit = 10
+
+// topColumn is a column TopDiff.Grid can print, and rank the namespaces by.
+type topColumn struct {
+	name string
+	key  func(info NSTopInfo) float64
+	cell func(info NSTopInfo) string
+}
+
+// topOps are the operations reported by top, in the order Grid prints them.
+var topOps = []struct {
+	name  string
+	field func(info NSTopInfo) TopField
+}{
+	{"total", func(info NSTopInfo) TopField { return info.Total }},
+	{"read", func(info NSTopInfo) TopField { return info.Read }},
+	{"write", func(info NSTopInfo) TopField { return info.Write }},
+	{"query", func(info NSTopInfo) TopField { return info.Query }},
+	{"getmore", func(info NSTopInfo) TopField { return info.Getmore }},
+	{"insert", func(info NSTopInfo) TopField { return info.Insert }},
+	{"update", func(info NSTopInfo) TopField { return info.Update }},
+	{"remove", func(info NSTopInfo) TopField { return info.Remove }},
+	{"cmd", func(info NSTopInfo) TopField { return info.Command }},
+}
+
+// topColumns maps the column names to the columns: "<op>" for the time spent,
+// "<op>cnt" for the count and "<op>avg" for the average latency of each op.
+var topColumns = map[string]topColumn{}
+
+func init() {
+	for _, op := range topOps {
+		field := op.field
+		topColumns[op.name] = topColumn{
+			name: op.name,
+			key:  func(info NSTopInfo) float64 { return float64(field(info).TimeMicros) },
+			cell: func(info NSTopInfo) string { return fmt.Sprintf("%vms", field(info).Time) },
+		}
+		topColumns[op.name+"cnt"] = topColumn{
+			name: op.name + "cnt",
+			key:  func(info NSTopInfo) float64 { return float64(field(info).Count) },
+			cell: func(info NSTopInfo) string { return fmt.Sprintf("%v", field(info).Count) },
+		}
+		topColumns[op.name+"avg"] = topColumn{
+			name: op.name + "avg",
+			key:  func(info NSTopInfo) float64 { return field(info).average() },
+			cell: func(info NSTopInfo) string { return fmt.Sprintf("%.2fms", field(info).average()) },
+		}
+	}
+}
+
+// average returns the time per operation in milliseconds.
+func (field TopField) average() float64 {
+	if field.Count == 0 {
+		return 0
+	}
+	return float64(field.TimeMicros) / 1000 / float64(field.Count)
+}
+
+// lockColumn is a column ServerStatusDiff.Grid can print, and rank the
+// databases by.
+type lockColumn struct {
+	name string
+	key  func(delta LockDelta) float64
+	cell func(delta LockDelta) string
+}
+
+// lockColumnOrder is the order ServerStatusDiff.Grid prints its columns in
+// for 2.x servers, and acquiringColumnOrder the order for 3.0+ servers.
+var (
+	lockColumnOrder      = []string{"total", "read", "write"}
+	acquiringColumnOrder = []string{"acquire", "waits", "acquiring", "wait"}
+)
+
+var lockColumns = map[string]lockColumn{
+	"total": {
+		name: "total",
+		key:  func(d LockDelta) float64 { return float64(d.ReadMicros + d.WriteMicros) },
+		cell: func(d LockDelta) string { return fmt.Sprintf("%vms", (d.ReadMicros+d.WriteMicros)/1000) },
+	},
+	"read": {
+		name: "read",
+		key:  func(d LockDelta) float64 { return float64(d.ReadMicros) },
+		cell: func(d LockDelta) string { return fmt.Sprintf("%vms", d.Read) },
+	},
+	"write": {
+		name: "write",
+		key:  func(d LockDelta) float64 { return float64(d.WriteMicros) },
+		cell: func(d LockDelta) string { return fmt.Sprintf("%vms", d.Write) },
+	},
+	"wait": {
+		name: "wait",
+		key:  func(d LockDelta) float64 { return d.WaitPercentage },
+		cell: func(d LockDelta) string { return fmt.Sprintf("%.1f%%", d.WaitPercentage) },
+	},
+	"acquire": {
+		name: "acquire",
+		key:  func(d LockDelta) float64 { return d.AcquireRate.sum() },
+		cell: func(d LockDelta) string { return d.AcquireRate.cell(1, "%.0f") },
+	},
+	"waits": {
+		name: "waits",
+		key:  func(d LockDelta) float64 { return d.WaitRate.sum() },
+		cell: func(d LockDelta) string { return d.WaitRate.cell(1, "%.1f") },
+	},
+	"acquiring": {
+		name: "acquiring",
+		key:  func(d LockDelta) float64 { return d.AcquiringRate.sum() },
+		cell: func(d LockDelta) string { return d.AcquiringRate.cell(1000, "%.1f") },
+	},
+}
+
+// cell formats the rates as "r|w|R|W", i.e. intent shared, intent exclusive,
+// shared and exclusive, after dividing them by scale.
+func (rates *LockModeRates) cell(scale float64, format string) string {
+	if rates == nil {
+		return ""
+	}
+	cells := []string{}
+	for _, rate := range []float64{rates.IntentShared, rates.IntentExclusive, rates.Shared, rates.Exclusive} {
+		cells = append(cells, fmt.Sprintf(format, rate/scale))
+	}
+	return strings.Join(cells, "|")
+}
+
+// Validate checks the sort key and the columns against the view selected by
+// Locks: the top columns, or the lock columns. It also checks the namespace
+// patterns.
+func (o *Output) Validate() error {
+	known := func(name string) bool {
+		_, ok := topColumns[name]
+		return ok
+	}
+	if o.Locks {
+		known = func(name string) bool {
+			_, ok := lockColumns[name]
+			return ok
+		}
+	}
+
+	if o.Sort != "" && !known(o.Sort) {
+		return fmt.Errorf("unknown sort key '%v'", o.Sort)
+	}
+	unknown := []string{}
+	for _, name := range o.Columns {
+		if !known(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown columns: %v", strings.Join(unknown, ", "))
+	}
+
+	// locks are reported per database, or per resource on 3.0+ servers,
+	// which the namespace patterns do not select
+	if o.Locks && (len(o.Include) > 0 || len(o.Exclude) > 0) {
+		return fmt.Errorf("include and exclude patterns do not apply to lock reporting")
+	}
+	_, err := NewNamespaceFilter(o.Include, o.Exclude)
+	return err
+}
+
+// sortKey returns the column the rows are ranked by.
+func (o *Output) sortKey() string {
+	if o == nil || o.Sort == "" {
+		return "total"
+	}
+	return o.Sort
+}
+
+// limit returns how many rows Grid prints, or a negative number for all.
+func (o *Output) limit() int {
+	if o == nil || o.Limit == 0 {
+		return defaultGridLimit
+	}
+	return o.Limit
+}
+
+// gridTopColumns returns the columns TopDiff.Grid prints.
+func (o *Output) gridTopColumns() []topColumn {
+	if o != nil && len(o.Columns) > 0 {
+		columns := make([]topColumn, 0, len(o.Columns))
+		for _, name := range o.Columns {
+			if column, ok := topColumns[name]; ok {
+				columns = append(columns, column)
+			}
+		}
+		return columns
+	}
+
+	columns := make([]topColumn, 0, 3*len(topOps))
+	for _, op := range topOps {
+		columns = append(columns, topColumns[op.name], topColumns[op.name+"cnt"])
+		if o != nil && o.Latency {
+			columns = append(columns, topColumns[op.name+"avg"])
+		}
+	}
+	return columns
+}
+
+// gridLockColumns returns the columns ServerStatusDiff.Grid prints. By
+// default these are the acquire rates for 3.0+ servers, which report them,
+// and the time each lock was held for 2.x servers.
+func (o *Output) gridLockColumns(acquiring bool) []lockColumn {
+	names := lockColumnOrder
+	if acquiring {
+		names = acquiringColumnOrder
+	}
+	if o != nil && len(o.Columns) > 0 {
+		names = o.Columns
+	}
+
+	columns := make([]lockColumn, 0, len(names))
+	for _, name := range names {
+		if column, ok := lockColumns[name]; ok {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
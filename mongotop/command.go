@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/xkeyideal/mongo-tools/common/text"
@@ -21,7 +22,8 @@ type FormattableDiff interface {
 
 // ServerStatus represents the results of the "serverStatus" command.
 type ServerStatus struct {
-	Locks map[string]LockStats `bson:"locks,omitempty"`
+	UptimeMillis int64                `bson:"uptimeMillis"`
+	Locks        map[string]LockStats `bson:"locks,omitempty"`
 }
 
 // LockStats contains information on time spent acquiring and holding a lock.
@@ -43,29 +45,117 @@ type ReadWriteLockTimes struct {
 	WriteLower int64 `bson:"w"`
 }
 
-// ServerStatusDiff contains a map of the lock time differences for each database.
+// ServerStatusDiff contains a map of the lock time differences for each
+// database, or for each lock resource but Global of a 3.0+ server.
 type ServerStatusDiff struct {
-	// namespace -> lock times
+	// database or resource -> lock times
 	Totals map[string]LockDelta `json:"totals"`
 	Time   time.Time            `json:"time"`
+
+	// IntervalMicros is the time between the two samples, by the server's uptime
+	IntervalMicros int64 `json:"intervalMicros"`
+
+	// Acquiring is set when the deltas are the time spent waiting to acquire
+	// the locks, which is all 3.0+ servers report, rather than holding them.
+	Acquiring bool `json:"acquiring"`
+
+	// Restarted is set when the server's uptime went backwards: its counters
+	// started over, so the deltas cover the time since it restarted.
+	Restarted bool `json:"restarted,omitempty"`
+
+	// Databases that appeared, had their counters reset, or disappeared
+	// since the previous sample
+	Created []string `json:"created,omitempty"`
+	Reset   []string `json:"reset,omitempty"`
+	Dropped []string `json:"dropped,omitempty"`
+
+	// the ranking, limit and columns of Grid
+	output *Output
 }
 
-// LockDelta represents the differences in read/write lock times between two samples.
+// LockDelta represents the differences in read/write lock times between two
+// samples, in milliseconds.
 type LockDelta struct {
 	Read  int64 `json:"read"`
 	Write int64 `json:"write"`
+
+	// The same differences in microseconds
+	ReadMicros  int64 `json:"readMicros"`
+	WriteMicros int64 `json:"writeMicros"`
+
+	// WaitPercentage is the time all operations spent waiting to acquire
+	// the lock, as a percentage of the interval. The waits of concurrent
+	// operations add up, so it may exceed 100%. Only set when the
+	// ServerStatusDiff is Acquiring.
+	WaitPercentage float64 `json:"waitPercentage,omitempty"`
+
+	// The rates per lock mode over the interval, for 3.0+ servers: lock
+	// acquisitions, acquisitions that had to wait, and microseconds spent
+	// waiting, each per second.
+	AcquireRate   *LockModeRates `json:"acquireRate,omitempty"`
+	WaitRate      *LockModeRates `json:"waitRate,omitempty"`
+	AcquiringRate *LockModeRates `json:"acquiringMicrosRate,omitempty"`
+}
+
+// LockModeRates holds a rate for each of the lock modes of 3.0+ servers.
+type LockModeRates struct {
+	IntentShared    float64 `json:"r"`
+	IntentExclusive float64 `json:"w"`
+	Shared          float64 `json:"R"`
+	Exclusive       float64 `json:"W"`
+}
+
+// newLockModeRates returns the per second rates of the lock counters between
+// two samples, or false if one of them went backwards.
+func newLockModeRates(cur, previous ReadWriteLockTimes, seconds float64) (*LockModeRates, bool) {
+	if cur.ReadLower < previous.ReadLower || cur.WriteLower < previous.WriteLower ||
+		cur.Read < previous.Read || cur.Write < previous.Write {
+		return nil, false
+	}
+	rates := &LockModeRates{}
+	if seconds > 0 {
+		rates.IntentShared = float64(cur.ReadLower-previous.ReadLower) / seconds
+		rates.IntentExclusive = float64(cur.WriteLower-previous.WriteLower) / seconds
+		rates.Shared = float64(cur.Read-previous.Read) / seconds
+		rates.Exclusive = float64(cur.Write-previous.Write) / seconds
+	}
+	return rates, true
+}
+
+// sum returns the rate across all the lock modes.
+func (rates *LockModeRates) sum() float64 {
+	if rates == nil {
+		return 0
+	}
+	return rates.IntentShared + rates.IntentExclusive + rates.Shared + rates.Exclusive
 }
 
 // TopDiff contains a map of the differences between top samples for each namespace.
+// Times are in milliseconds, or microseconds in the TimeMicros fields.
 type TopDiff struct {
 	// namespace -> totals
 	Totals map[string]NSTopInfo `json:"totals"`
 	Time   time.Time            `json:"time"`
+
+	// IntervalMicros is the time between the two samples
+	IntervalMicros int64 `json:"intervalMicros"`
+
+	// Namespaces that appeared, had their counters reset, or disappeared
+	// since the previous sample
+	Created []string `json:"created,omitempty"`
+	Reset   []string `json:"reset,omitempty"`
+	Dropped []string `json:"dropped,omitempty"`
+
+	// the ranking, limit and columns of Grid
+	output *Output
 }
 
 // Top holds raw output of the "top" command.
 type Top struct {
 	Totals map[string]NSTopInfo `bson:"totals"`
+
+	// when the sample was taken, to compute the interval of a TopDiff
+	sampleTime time.Time
 }
 
 // NSTopInfo holds information about a single namespace.
@@ -82,15 +172,18 @@ type NSTopInfo struct {
 }
 
 // TopField contains the timing and counts for a single lock statistic within the "top" command.
+// Time is in microseconds as the server reports it, and in milliseconds in a
+// TopDiff, which keeps the microseconds in TimeMicros.
 type TopField struct {
-	Time  int `bson:"time" json:"time"`
-	Count int `bson:"count" json:"count"`
+	Time       int `bson:"time" json:"time"`
+	TimeMicros int `bson:"-" json:"timeMicros"`
+	Count      int `bson:"count" json:"count"`
 }
 
 // struct to enable sorting of namespaces by lock time with the sort package
 type sortableTotal struct {
 	Name  string
-	Total int64
+	Total float64
 }
 
 type sortableTotals []sortableTotal
@@ -106,161 +199,239 @@ func (a sortableTotals) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
 
 // Diff takes an older Top sample, and produces a TopDiff
 // representing the deltas of each metric between the two samples.
-func (top Top) Diff(previous Top) TopDiff {
+// Only the namespaces matched by filter are included, every one if it is nil.
+//
+// A namespace missing from the older sample was created during the interval,
+// and one whose counters went backwards was dropped and recreated; for both
+// the counters started from zero, so their whole value is the delta.
+func (top Top) Diff(previous Top, filter *NamespaceFilter) TopDiff {
 	// The diff to eventually return
 	diff := TopDiff{
 		Totals: map[string]NSTopInfo{},
 		Time:   time.Now(),
 	}
+	if !top.sampleTime.IsZero() && !previous.sampleTime.IsZero() {
+		diff.IntervalMicros = int64(top.sampleTime.Sub(previous.sampleTime) / time.Microsecond)
+	}
 
 	// For each namespace we are tracking, subtract the times and counts
-	// for total/read/write and build a new map containing the diffs.
+	// for every operation and build a new map containing the diffs.
 	prevTotals := previous.Totals
 	curTotals := top.Totals
-	for ns, prevNSInfo := range prevTotals {
-		if curNSInfo, ok := curTotals[ns]; ok {
-			diff.Totals[ns] = NSTopInfo{
-				Total: TopField{
-					Time:  (curNSInfo.Total.Time - prevNSInfo.Total.Time) / 1000,
-					Count: curNSInfo.Total.Count - prevNSInfo.Total.Count,
-				},
-				Read: TopField{
-					Time:  (curNSInfo.Read.Time - prevNSInfo.Read.Time) / 1000,
-					Count: curNSInfo.Read.Count - prevNSInfo.Read.Count,
-				},
-				Write: TopField{
-					Time:  (curNSInfo.Write.Time - prevNSInfo.Write.Time) / 1000,
-					Count: curNSInfo.Write.Count - prevNSInfo.Write.Count,
-				},
-				Query: TopField{
-					Time:  (curNSInfo.Query.Time - prevNSInfo.Query.Time) / 1000,
-					Count: curNSInfo.Query.Count - prevNSInfo.Query.Count,
-				},
-				Insert: TopField{
-					Time:  (curNSInfo.Insert.Time - prevNSInfo.Insert.Time) / 1000,
-					Count: curNSInfo.Insert.Count - prevNSInfo.Insert.Count,
-				},
-				Getmore: TopField{
-					Time:  (curNSInfo.Getmore.Time - prevNSInfo.Getmore.Time) / 1000,
-					Count: curNSInfo.Getmore.Count - prevNSInfo.Getmore.Count,
-				},
-				Update: TopField{
-					Time:  (curNSInfo.Update.Time - prevNSInfo.Update.Time) / 1000,
-					Count: curNSInfo.Update.Count - prevNSInfo.Update.Count,
-				},
-				Remove: TopField{
-					Time:  (curNSInfo.Remove.Time - prevNSInfo.Remove.Time) / 1000,
-					Count: curNSInfo.Remove.Count - prevNSInfo.Remove.Count,
-				},
-				Command: TopField{
-					Time:  (curNSInfo.Command.Time - prevNSInfo.Command.Time) / 1000,
-					Count: curNSInfo.Command.Count - prevNSInfo.Command.Count,
-				},
-			}
+	for ns, curNSInfo := range curTotals {
+		if !filter.Match(ns) {
+			continue
+		}
+		prevNSInfo, ok := prevTotals[ns]
+		if !ok {
+			diff.Created = append(diff.Created, ns)
+		} else if curNSInfo.regressed(prevNSInfo) {
+			diff.Reset = append(diff.Reset, ns)
+			prevNSInfo = NSTopInfo{}
 		}
+		diff.Totals[ns] = curNSInfo.sub(prevNSInfo)
 	}
+	for ns := range prevTotals {
+		if _, ok := curTotals[ns]; !ok && filter.Match(ns) {
+			diff.Dropped = append(diff.Dropped, ns)
+		}
+	}
+	sort.Strings(diff.Created)
+	sort.Strings(diff.Reset)
+	sort.Strings(diff.Dropped)
 	return diff
 }
 
+// sub returns the deltas between two samples of a namespace.
+func (info NSTopInfo) sub(previous NSTopInfo) NSTopInfo {
+	return NSTopInfo{
+		Total:   info.Total.sub(previous.Total),
+		Read:    info.Read.sub(previous.Read),
+		Write:   info.Write.sub(previous.Write),
+		Query:   info.Query.sub(previous.Query),
+		Getmore: info.Getmore.sub(previous.Getmore),
+		Insert:  info.Insert.sub(previous.Insert),
+		Update:  info.Update.sub(previous.Update),
+		Remove:  info.Remove.sub(previous.Remove),
+		Command: info.Command.sub(previous.Command),
+	}
+}
+
+func (field TopField) sub(previous TopField) TopField {
+	micros := field.Time - previous.Time
+	return TopField{
+		Time:       micros / 1000,
+		TimeMicros: micros,
+		Count:      field.Count - previous.Count,
+	}
+}
+
+// regressed reports whether any counter is lower than in the previous
+// sample, which means the counters of the namespace were reset.
+func (info NSTopInfo) regressed(previous NSTopInfo) bool {
+	for _, op := range topOps {
+		cur, prev := op.field(info), op.field(previous)
+		if cur.Time < prev.Time || cur.Count < prev.Count {
+			return true
+		}
+	}
+	return false
+}
+
 // Grid returns a tabular representation of the TopDiff.
 func (td TopDiff) Grid() string {
+	header, rows := td.table()
 	buf := &bytes.Buffer{}
 	out := &text.GridWriter{ColumnPadding: 2}
-	out.WriteCells("ns", "total", "totalcnt", "read", "readcnt", "write", "writecnt",
-		"query", "querycnt", "getmore", "getmorecnt", "insert", "insertcnt", "update", "updatecnt",
-		"remove", "removecnt", "cmd", "cmdcnt",
-		time.Now().Format("2006-01-02T15:04:05Z07:00"))
-	out.EndRow()
+	writeGrid(out, header, rows)
+	out.Flush(buf)
+	writeDropped(buf, td.Dropped)
+	return buf.String()
+}
 
-	//Sort by total time
+// table returns the header and rows of the TopDiff, with the columns,
+// ranking and limit of its Output applied. Times are in milliseconds.
+func (td TopDiff) table() ([]string, [][]string) {
+	columns := td.output.gridTopColumns()
+	header := []string{"ns"}
+	for _, column := range columns {
+		header = append(header, column.name)
+	}
+
+	//Sort by the chosen column, total time by default
+	key := topColumns["total"].key
+	if column, ok := topColumns[td.output.sortKey()]; ok {
+		key = column.key
+	}
 	totals := make(sortableTotals, 0, len(td.Totals))
 	for ns, diff := range td.Totals {
-		totals = append(totals, sortableTotal{ns, int64(diff.Total.Time)})
+		totals = append(totals, sortableTotal{ns, key(diff)})
 	}
 
 	sort.Sort(sort.Reverse(totals))
+	limit := td.output.limit()
+	rows := [][]string{}
 	for i, st := range totals {
-		diff := td.Totals[st.Name]
-		out.WriteCells(st.Name,
-			fmt.Sprintf("%vms", diff.Total.Time),
-			fmt.Sprintf("%v", diff.Total.Count),
-			fmt.Sprintf("%vms", diff.Read.Time),
-			fmt.Sprintf("%v", diff.Read.Count),
-			fmt.Sprintf("%vms", diff.Write.Time),
-			fmt.Sprintf("%v", diff.Write.Count),
-			fmt.Sprintf("%vms", diff.Query.Time),
-			fmt.Sprintf("%v", diff.Query.Count),
-			fmt.Sprintf("%vms", diff.Getmore.Time),
-			fmt.Sprintf("%v", diff.Getmore.Count),
-			fmt.Sprintf("%vms", diff.Insert.Time),
-			fmt.Sprintf("%v", diff.Insert.Count),
-			fmt.Sprintf("%vms", diff.Update.Time),
-			fmt.Sprintf("%v", diff.Update.Count),
-			fmt.Sprintf("%vms", diff.Remove.Time),
-			fmt.Sprintf("%v", diff.Remove.Count),
-			fmt.Sprintf("%vms", diff.Command.Time),
-			fmt.Sprintf("%v", diff.Command.Count),
-			"")
-		out.EndRow()
-		if i >= 9 {
+		if limit >= 0 && i >= limit {
 			break
 		}
+		diff := td.Totals[st.Name]
+		row := []string{st.Name}
+		for _, column := range columns {
+			row = append(row, column.cell(diff))
+		}
+		rows = append(rows, row)
+	}
+	return header, rows
+}
+
+func (td TopDiff) sampleTime() time.Time {
+	return td.Time
+}
+
+// writeGrid writes the table, with the current time after the header and
+// an empty cell to match after each row.
+func writeGrid(out *text.GridWriter, header []string, rows [][]string) {
+	out.WriteCells(header...)
+	out.WriteCell(time.Now().Format("2006-01-02T15:04:05Z07:00"))
+	out.EndRow()
+	for _, row := range rows {
+		out.WriteCells(row...)
+		out.WriteCell("")
+		out.EndRow()
+	}
+}
+
+// writeDropped notes the namespaces that disappeared below a grid.
+func writeDropped(buf *bytes.Buffer, dropped []string) {
+	if len(dropped) > 0 {
+		fmt.Fprintf(buf, "dropped: %v\n", strings.Join(dropped, ", "))
 	}
-	out.Flush(buf)
-	return buf.String()
 }
 
 // JSON returns a JSON representation of the TopDiff.
 func (td TopDiff) JSON() string {
-	bytes, err := json.Marshal(td)
-	if err != nil {
-		panic(err)
-	}
-	return string(bytes)
+	return marshalDiff(td)
 }
 
 // JSON returns a JSON representation of the ServerStatusDiff.
 func (ssd ServerStatusDiff) JSON() string {
-	bytes, err := json.Marshal(ssd)
+	return marshalDiff(ssd)
+}
+
+// marshalDiff returns the JSON of a diff, or of the error marshaling it.
+// Use the "json" formatter to get the error back instead.
+func marshalDiff(diff FormattableDiff) string {
+	bytes, err := json.Marshal(diff)
 	if err != nil {
-		panic(err)
+		return fmt.Sprintf(`{"json error": "%v"}`, err.Error())
 	}
 	return string(bytes)
 }
 
 // Grid returns a tabular representation of the ServerStatusDiff.
 func (ssd ServerStatusDiff) Grid() string {
+	header, rows := ssd.table()
 	buf := &bytes.Buffer{}
 	out := &text.GridWriter{ColumnPadding: 4}
-	out.WriteCells("db", "total", "read", "write", time.Now().Format("2006-01-02T15:04:05Z07:00"))
-	out.EndRow()
+	writeGrid(out, header, rows)
+	out.Flush(buf)
+	if ssd.Restarted {
+		fmt.Fprintf(buf, "server restarted, deltas are since it started\n")
+	}
+	writeDropped(buf, ssd.Dropped)
+	return buf.String()
+}
 
-	//Sort by total time
+// table returns the header and rows of the ServerStatusDiff, with the
+// columns, ranking and limit of its Output applied.
+func (ssd ServerStatusDiff) table() ([]string, [][]string) {
+	columns := ssd.output.gridLockColumns(ssd.Acquiring)
+	// 3.0+ servers report locks per resource type rather than per database
+	header := []string{"db"}
+	if ssd.Acquiring {
+		header = []string{"resource"}
+	}
+	for _, column := range columns {
+		header = append(header, column.name)
+	}
+
+	//Sort by the chosen column, total time by default
+	key := lockColumns["total"].key
+	if column, ok := lockColumns[ssd.output.sortKey()]; ok {
+		key = column.key
+	}
 	totals := make(sortableTotals, 0, len(ssd.Totals))
 	for ns, diff := range ssd.Totals {
-		totals = append(totals, sortableTotal{ns, diff.Read + diff.Write})
+		totals = append(totals, sortableTotal{ns, key(diff)})
 	}
 
 	sort.Sort(sort.Reverse(totals))
+	limit := ssd.output.limit()
+	rows := [][]string{}
 	for i, st := range totals {
-		diff := ssd.Totals[st.Name]
-		out.WriteCells(st.Name,
-			fmt.Sprintf("%vms", diff.Read+diff.Write),
-			fmt.Sprintf("%vms", diff.Read),
-			fmt.Sprintf("%vms", diff.Write),
-			"")
-		out.EndRow()
-		if i >= 9 {
+		if limit >= 0 && i >= limit {
 			break
 		}
+		diff := ssd.Totals[st.Name]
+		row := []string{st.Name}
+		for _, column := range columns {
+			row = append(row, column.cell(diff))
+		}
+		rows = append(rows, row)
 	}
+	return header, rows
+}
 
-	out.Flush(buf)
-	return buf.String()
+func (ssd ServerStatusDiff) sampleTime() time.Time {
+	return ssd.Time
 }
 
 // Diff takes an older ServerStatus sample, and produces a ServerStatusDiff
-// representing the deltas of each metric between the two samples.
+// representing the deltas of each metric between the two samples. Databases
+// that are new or whose counters went backwards are diffed against zero, like
+// in Top.Diff. If the server restarted in between, every database is diffed
+// against zero over its new uptime, so no rate is negative.
 func (ss ServerStatus) Diff(previous ServerStatus) ServerStatusDiff {
 	// the diff to eventually return
 	diff := ServerStatusDiff{
@@ -268,21 +439,121 @@ func (ss ServerStatus) Diff(previous ServerStatus) ServerStatusDiff {
 		Time:   time.Now(),
 	}
 
+	// lock times are in microseconds and uptime is in milliseconds
+	intervalMicros := (ss.UptimeMillis - previous.UptimeMillis) * 1000
+	if intervalMicros < 0 {
+		diff.Restarted = true
+		intervalMicros = ss.UptimeMillis * 1000
+	}
+	diff.IntervalMicros = intervalMicros
+
 	prevLocks := previous.Locks
 	curLocks := ss.Locks
+	for ns, curNSInfo := range curLocks {
+		if curNSInfo.AcquireCount != nil {
+			diff.Acquiring = true
+		}
+		if isGlobalResource(ns, curNSInfo) {
+			continue
+		}
+		prevNSInfo, ok := prevLocks[ns]
+		if !ok {
+			diff.Created = append(diff.Created, ns)
+		} else if diff.Restarted {
+			diff.Reset = append(diff.Reset, ns)
+			prevNSInfo = LockStats{}
+		}
+		delta, valid := curNSInfo.sub(prevNSInfo, intervalMicros)
+		if !valid {
+			diff.Reset = append(diff.Reset, ns)
+			delta, _ = curNSInfo.sub(LockStats{}, intervalMicros)
+		}
+		diff.Totals[ns] = delta
+	}
 	for ns, prevNSInfo := range prevLocks {
-		if curNSInfo, ok := curLocks[ns]; ok {
-			prevTimeLocked := prevNSInfo.TimeLockedMicros
-			curTimeLocked := curNSInfo.TimeLockedMicros
-
-			diff.Totals[ns] = LockDelta{
-				Read: (curTimeLocked.Read + curTimeLocked.ReadLower -
-					(prevTimeLocked.Read + prevTimeLocked.ReadLower)) / 1000,
-				Write: (curTimeLocked.Write + curTimeLocked.WriteLower -
-					(prevTimeLocked.Write + prevTimeLocked.WriteLower)) / 1000,
-			}
+		if _, ok := curLocks[ns]; !ok && !isGlobalResource(ns, prevNSInfo) {
+			diff.Dropped = append(diff.Dropped, ns)
 		}
 	}
-
+	sort.Strings(diff.Created)
+	sort.Strings(diff.Reset)
+	sort.Strings(diff.Dropped)
 	return diff
 }
+
+// isGlobalResource reports whether the locks are those of the Global resource
+// of a 3.0+ server. Every operation takes it, so it would always rank first
+// and hide the resources actually contended.
+func isGlobalResource(name string, stats LockStats) bool {
+	return name == "Global" && stats.AcquireCount != nil
+}
+
+// sub returns the lock deltas between two samples. 3.0+ servers, which report
+// acquire counts, are diffed by the time spent acquiring each lock, along with
+// the rates per lock mode; 2.x servers by the time each lock was held.
+// It returns false if a counter went backwards.
+func (cur LockStats) sub(previous LockStats, intervalMicros int64) (LockDelta, bool) {
+	if cur.AcquireCount != nil {
+		prevAcquiring := previous.TimeAcquiringMicros
+		curAcquiring := cur.TimeAcquiringMicros
+
+		readMicros := curAcquiring.Read + curAcquiring.ReadLower -
+			(prevAcquiring.Read + prevAcquiring.ReadLower)
+		writeMicros := curAcquiring.Write + curAcquiring.WriteLower -
+			(prevAcquiring.Write + prevAcquiring.WriteLower)
+		if readMicros < 0 || writeMicros < 0 {
+			return LockDelta{}, false
+		}
+
+		delta := LockDelta{
+			Read:        readMicros / 1000,
+			Write:       writeMicros / 1000,
+			ReadMicros:  readMicros,
+			WriteMicros: writeMicros,
+		}
+		if intervalMicros > 0 {
+			delta.WaitPercentage = 100 * float64(readMicros+writeMicros) / float64(intervalMicros)
+		}
+
+		seconds := float64(intervalMicros) / 1e6
+		var prevAcquire, prevWait, curWait ReadWriteLockTimes
+		if previous.AcquireCount != nil {
+			prevAcquire = *previous.AcquireCount
+		}
+		if previous.AcquireWaitCount != nil {
+			prevWait = *previous.AcquireWaitCount
+		}
+		if cur.AcquireWaitCount != nil {
+			curWait = *cur.AcquireWaitCount
+		}
+
+		var ok bool
+		if delta.AcquireRate, ok = newLockModeRates(*cur.AcquireCount, prevAcquire, seconds); !ok {
+			return LockDelta{}, false
+		}
+		if delta.WaitRate, ok = newLockModeRates(curWait, prevWait, seconds); !ok {
+			return LockDelta{}, false
+		}
+		if delta.AcquiringRate, ok = newLockModeRates(curAcquiring, prevAcquiring, seconds); !ok {
+			return LockDelta{}, false
+		}
+		return delta, true
+	}
+
+	prevTimeLocked := previous.TimeLockedMicros
+	curTimeLocked := cur.TimeLockedMicros
+
+	readMicros := curTimeLocked.Read + curTimeLocked.ReadLower -
+		(prevTimeLocked.Read + prevTimeLocked.ReadLower)
+	writeMicros := curTimeLocked.Write + curTimeLocked.WriteLower -
+		(prevTimeLocked.Write + prevTimeLocked.WriteLower)
+	if readMicros < 0 || writeMicros < 0 {
+		return LockDelta{}, false
+	}
+	return LockDelta{
+		Read:        readMicros / 1000,
+		Write:       writeMicros / 1000,
+		ReadMicros:  readMicros,
+		WriteMicros: writeMicros,
+	}, true
+}
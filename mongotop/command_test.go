@@ -0,0 +1,224 @@
+package mongotop
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// nsInfo returns the top counters of a namespace that saw n queries and n
+// inserts, each taking 1500 microseconds.
+func nsInfo(n int) NSTopInfo {
+	field := TopField{Time: 1500 * n, Count: n}
+	return NSTopInfo{
+		Total:  TopField{Time: 3000 * n, Count: 2 * n},
+		Read:   field,
+		Write:  field,
+		Query:  field,
+		Insert: field,
+	}
+}
+
+// nsDelta returns the delta of nsInfo(n) against an empty sample, with the
+// times in milliseconds and microseconds.
+func nsDelta(n int) NSTopInfo {
+	field := TopField{Time: 1500 * n / 1000, TimeMicros: 1500 * n, Count: n}
+	return NSTopInfo{
+		Total:  TopField{Time: 3 * n, TimeMicros: 3000 * n, Count: 2 * n},
+		Read:   field,
+		Write:  field,
+		Query:  field,
+		Insert: field,
+	}
+}
+
+func newTop(at time.Time, totals map[string]NSTopInfo) Top {
+	return Top{Totals: totals, sampleTime: at}
+}
+
+func TestTopDiff(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name     string
+		previous map[string]NSTopInfo
+		current  map[string]NSTopInfo
+		filter   []string
+
+		totals                  map[string]NSTopInfo
+		created, reset, dropped []string
+	}{
+		{
+			name:     "unchanged namespaces",
+			previous: map[string]NSTopInfo{"test.a": nsInfo(1)},
+			current:  map[string]NSTopInfo{"test.a": nsInfo(3)},
+			totals:   map[string]NSTopInfo{"test.a": nsDelta(2)},
+		},
+		{
+			name:     "namespace created mid-run",
+			previous: map[string]NSTopInfo{"test.a": nsInfo(1)},
+			current:  map[string]NSTopInfo{"test.a": nsInfo(1), "test.b": nsInfo(4)},
+			totals:   map[string]NSTopInfo{"test.a": nsDelta(0), "test.b": nsDelta(4)},
+			created:  []string{"test.b"},
+		},
+		{
+			name:     "namespace dropped",
+			previous: map[string]NSTopInfo{"test.a": nsInfo(1), "test.b": nsInfo(4)},
+			current:  map[string]NSTopInfo{"test.a": nsInfo(2)},
+			totals:   map[string]NSTopInfo{"test.a": nsDelta(1)},
+			dropped:  []string{"test.b"},
+		},
+		{
+			name:     "namespace dropped and recreated",
+			previous: map[string]NSTopInfo{"test.a": nsInfo(5)},
+			current:  map[string]NSTopInfo{"test.a": nsInfo(2)},
+			totals:   map[string]NSTopInfo{"test.a": nsDelta(2)},
+			reset:    []string{"test.a"},
+		},
+		{
+			name:     "filtered namespaces",
+			previous: map[string]NSTopInfo{"test.a": nsInfo(1), "local.b": nsInfo(1), "test.gone": nsInfo(1)},
+			current:  map[string]NSTopInfo{"test.a": nsInfo(2), "local.b": nsInfo(3), "local.c": nsInfo(1)},
+			filter:   []string{"local"},
+			totals:   map[string]NSTopInfo{"test.a": nsDelta(1)},
+			dropped:  []string{"test.gone"},
+		},
+	}
+
+	for _, test := range tests {
+		filter, err := NewNamespaceFilter(nil, test.filter)
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		previous := newTop(start, test.previous)
+		current := newTop(start.Add(time.Second), test.current)
+		diff := current.Diff(previous, filter)
+
+		if !reflect.DeepEqual(diff.Totals, test.totals) {
+			t.Errorf("%v: got totals %+v, want %+v", test.name, diff.Totals, test.totals)
+		}
+		if !reflect.DeepEqual(diff.Created, test.created) {
+			t.Errorf("%v: got created %v, want %v", test.name, diff.Created, test.created)
+		}
+		if !reflect.DeepEqual(diff.Reset, test.reset) {
+			t.Errorf("%v: got reset %v, want %v", test.name, diff.Reset, test.reset)
+		}
+		if !reflect.DeepEqual(diff.Dropped, test.dropped) {
+			t.Errorf("%v: got dropped %v, want %v", test.name, diff.Dropped, test.dropped)
+		}
+		if diff.IntervalMicros != int64(time.Second/time.Microsecond) {
+			t.Errorf("%v: got interval %v", test.name, diff.IntervalMicros)
+		}
+	}
+}
+
+// acquiring returns the 3.0+ locks of a resource that was acquired n times
+// in each mode, waiting n microseconds each time.
+func acquiring(n int64) LockStats {
+	times := ReadWriteLockTimes{Read: n, Write: n, ReadLower: n, WriteLower: n}
+	return LockStats{
+		AcquireCount:        &times,
+		AcquireWaitCount:    &times,
+		TimeAcquiringMicros: times,
+	}
+}
+
+func TestServerStatusDiff(t *testing.T) {
+	previous := ServerStatus{
+		UptimeMillis: 10000,
+		Locks: map[string]LockStats{
+			"Global":     acquiring(100),
+			"Database":   acquiring(10),
+			"Collection": acquiring(50),
+			"Metadata":   acquiring(1),
+		},
+	}
+	current := ServerStatus{
+		UptimeMillis: 12000,
+		Locks: map[string]LockStats{
+			"Global":     acquiring(200),
+			"Database":   acquiring(30),
+			"Collection": acquiring(20),
+			"oplog":      acquiring(4),
+		},
+	}
+	diff := current.Diff(previous)
+
+	if !diff.Acquiring || diff.Restarted {
+		t.Errorf("got acquiring %v and restarted %v", diff.Acquiring, diff.Restarted)
+	}
+	if diff.IntervalMicros != 2000000 {
+		t.Errorf("got interval %v", diff.IntervalMicros)
+	}
+	if _, ok := diff.Totals["Global"]; ok {
+		t.Errorf("the Global resource is reported")
+	}
+	if got := diff.Totals["Database"]; got.ReadMicros != 40 || got.WriteMicros != 40 || got.AcquireRate.Shared != 10 {
+		t.Errorf("got Database delta %+v", got)
+	}
+	if got := diff.Totals["Collection"]; got.ReadMicros != 40 || got.AcquireRate.Shared != 10 {
+		t.Errorf("got Collection delta %+v, want it diffed against zero", got)
+	}
+	if !reflect.DeepEqual(diff.Created, []string{"oplog"}) ||
+		!reflect.DeepEqual(diff.Reset, []string{"Collection"}) ||
+		!reflect.DeepEqual(diff.Dropped, []string{"Metadata"}) {
+		t.Errorf("got created %v, reset %v and dropped %v", diff.Created, diff.Reset, diff.Dropped)
+	}
+}
+
+func TestServerStatusDiffTimeLocked(t *testing.T) {
+	previous := ServerStatus{
+		UptimeMillis: 10000,
+		Locks:        map[string]LockStats{"test": {TimeLockedMicros: ReadWriteLockTimes{Read: 1000, Write: 500}}},
+	}
+	current := ServerStatus{
+		UptimeMillis: 11000,
+		Locks:        map[string]LockStats{"test": {TimeLockedMicros: ReadWriteLockTimes{Read: 3500, Write: 2700}}},
+	}
+	diff := current.Diff(previous)
+
+	if diff.Acquiring {
+		t.Errorf("2.x locks reported as acquiring")
+	}
+	want := LockDelta{Read: 2, Write: 2, ReadMicros: 2500, WriteMicros: 2200}
+	if got := diff.Totals["test"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got delta %+v, want %+v", got, want)
+	}
+}
+
+func TestServerStatusDiffRestarted(t *testing.T) {
+	previous := ServerStatus{
+		UptimeMillis: 60000,
+		Locks:        map[string]LockStats{"Database": acquiring(500), "Collection": acquiring(1)},
+	}
+	current := ServerStatus{
+		UptimeMillis: 2000,
+		Locks:        map[string]LockStats{"Database": acquiring(20), "Collection": acquiring(2)},
+	}
+	diff := current.Diff(previous)
+
+	if !diff.Restarted {
+		t.Errorf("restart not detected")
+	}
+	if diff.IntervalMicros != 2000000 {
+		t.Errorf("got interval %v, want the uptime since the restart", diff.IntervalMicros)
+	}
+	if !reflect.DeepEqual(diff.Reset, []string{"Collection", "Database"}) {
+		t.Errorf("got reset %v", diff.Reset)
+	}
+	for ns, delta := range diff.Totals {
+		rates := []*LockModeRates{delta.AcquireRate, delta.WaitRate, delta.AcquiringRate}
+		for _, r := range rates {
+			if r == nil || r.IntentShared < 0 || r.IntentExclusive < 0 || r.Shared < 0 || r.Exclusive < 0 {
+				t.Errorf("%v: got rates %+v", ns, r)
+			}
+		}
+		if delta.WaitPercentage < 0 {
+			t.Errorf("%v: got wait percentage %v", ns, delta.WaitPercentage)
+		}
+	}
+	// counters that happen to be higher than before the restart still
+	// start from zero
+	if got := diff.Totals["Collection"]; got.ReadMicros != 4 || got.AcquireRate.Shared != 1 {
+		t.Errorf("got Collection delta %+v", got)
+	}
+}
@@ -0,0 +1,64 @@
+package mongotop
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"time"
+)
+
+// CSVFormatter prints the rows of the diffs as CSV, prefixed with the time of
+// the sample. The header is printed once, before the first rows.
+type CSVFormatter struct {
+	*limitableFormatter
+
+	// If true, enables printing of the header to output
+	includeHeader bool
+
+	printedHeader bool
+}
+
+func NewCSVFormatter(o *Output) (DiffFormatter, error) {
+	return &CSVFormatter{
+		limitableFormatter: &limitableFormatter{maxRows: int64(o.RowCount)},
+		includeHeader:      !o.NoHeaders,
+	}, nil
+}
+
+func init() {
+	FormatterConstructors["csv"] = NewCSVFormatter
+}
+
+func (cf *CSVFormatter) Finish() {
+}
+
+// FormatDiff formats the rows of the diff as CSV
+func (cf *CSVFormatter) FormatDiff(diff FormattableDiff) (string, error) {
+	tabular, ok := diff.(tabularDiff)
+	if !ok {
+		return "", fmt.Errorf("cannot format %T as CSV", diff)
+	}
+	header, rows := tabular.table()
+	sampleTime := tabular.sampleTime().Format(time.RFC3339Nano)
+
+	buf := &bytes.Buffer{}
+	out := csv.NewWriter(buf)
+	if cf.includeHeader && !cf.printedHeader {
+		if err := out.Write(append([]string{"time"}, header...)); err != nil {
+			return "", err
+		}
+		cf.printedHeader = true
+	}
+	for _, row := range rows {
+		if err := out.Write(append([]string{sampleTime}, row...)); err != nil {
+			return "", err
+		}
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return "", err
+	}
+
+	cf.increment()
+	return buf.String(), nil
+}
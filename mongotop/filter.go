@@ -0,0 +1,106 @@
+package mongotop
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/xkeyideal/mongo-tools/common/util"
+)
+
+// NamespaceFilter selects the namespaces mongotop reports. A namespace is
+// reported if it matches one of the include patterns, or there are none, and
+// none of the exclude patterns.
+//
+// A pattern is one of:
+//   - /regexp/, matched against the full namespace
+//   - a glob such as "admin.system.*" or "config*", see path.Match
+//   - a literal database or full namespace, such as "local" or "test.users"
+//
+// Globs and literals without a '.' match the database, the others match the
+// full namespace.
+type NamespaceFilter struct {
+	include, exclude []nsMatcher
+}
+
+type nsMatcher func(ns string) bool
+
+// NewNamespaceFilter compiles the include and exclude patterns.
+func NewNamespaceFilter(include, exclude []string) (*NamespaceFilter, error) {
+	filter := &NamespaceFilter{}
+	for _, pattern := range include {
+		matcher, err := compileNamespacePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.include = append(filter.include, matcher)
+	}
+	for _, pattern := range exclude {
+		matcher, err := compileNamespacePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.exclude = append(filter.exclude, matcher)
+	}
+	return filter, nil
+}
+
+func compileNamespacePattern(pattern string) (nsMatcher, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace pattern %v: %v", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+
+	byDatabase := !strings.Contains(pattern, ".")
+	target := func(ns string) string {
+		if byDatabase {
+			return strings.SplitN(ns, ".", 2)[0]
+		}
+		return ns
+	}
+
+	if strings.ContainsAny(pattern, "*?[") {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid namespace pattern %v: %v", pattern, err)
+		}
+		return func(ns string) bool {
+			matched, _ := path.Match(pattern, target(ns))
+			return matched
+		}, nil
+	}
+
+	if err := util.ValidateFullNamespace(pattern); err != nil {
+		return nil, err
+	}
+	return func(ns string) bool {
+		return target(ns) == pattern
+	}, nil
+}
+
+// Match reports whether the namespace should be reported. A nil
+// NamespaceFilter reports every namespace.
+func (filter *NamespaceFilter) Match(ns string) bool {
+	if filter == nil {
+		return true
+	}
+	included := len(filter.include) == 0
+	for _, match := range filter.include {
+		if match(ns) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, match := range filter.exclude {
+		if match(ns) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package mongotop
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// A DiffFormatter formats the diffs produced by mongotop for printing.
+type DiffFormatter interface {
+	// FormatDiff returns the string representation of the diff that is passed in.
+	FormatDiff(diff FormattableDiff) (string, error)
+
+	// IsFinished returns true iff the formatter cannot print any more data
+	IsFinished() bool
+	// Finish() is called when mongotop is shutting down so that the formatter can clean up
+	Finish()
+
+	ResetCount()
+}
+
+// tabularDiff is implemented by the diffs that can be laid out as a table,
+// which is what the grid and CSV formatters print.
+type tabularDiff interface {
+	table() (header []string, rows [][]string)
+	sampleTime() time.Time
+}
+
+type limitableFormatter struct {
+	// atomic operations are performed on rowCount, so these two variables
+	// should stay at the beginning for the sake of variable alignment
+	maxRows, rowCount int64
+}
+
+func (lf *limitableFormatter) increment() {
+	atomic.AddInt64(&lf.rowCount, 1)
+}
+
+func (lf *limitableFormatter) ResetCount() {
+	atomic.StoreInt64(&lf.rowCount, 0)
+}
+
+func (lf *limitableFormatter) IsFinished() bool {
+	return lf.maxRows > 0 && atomic.LoadInt64(&lf.rowCount) >= lf.maxRows
+}
+
+// FormatterConstructor creates a DiffFormatter from the output options,
+// e.g. the row count, headers and template.
+type FormatterConstructor func(o *Output) (DiffFormatter, error)
+
+var FormatterConstructors = map[string]FormatterConstructor{}
+
+// NewDiffFormatter creates the formatter named by o.Format, or the grid or
+// JSON formatter by o.Json if it is not set.
+func NewDiffFormatter(o *Output) (DiffFormatter, error) {
+	name := o.Format
+	if name == "" {
+		name = "grid"
+		if o.Json {
+			name = "json"
+		}
+	}
+	factory, ok := FormatterConstructors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format '%v'", name)
+	}
+	return factory(o)
+}
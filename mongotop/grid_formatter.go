@@ -0,0 +1,55 @@
+package mongotop
+
+import (
+	"strings"
+)
+
+// headerInterval is the number of outputs before the header is re-printed in GridFormatter
+const headerInterval = 10
+
+// GridFormatter prints the diffs as tables, like FormattableDiff.Grid
+type GridFormatter struct {
+	*limitableFormatter
+
+	// If true, enables printing of headers to output
+	includeHeader bool
+
+	// Counter for periodic headers
+	index int
+}
+
+func NewGridFormatter(o *Output) (DiffFormatter, error) {
+	return &GridFormatter{
+		limitableFormatter: &limitableFormatter{maxRows: int64(o.RowCount)},
+		includeHeader:      !o.NoHeaders,
+	}, nil
+}
+
+func init() {
+	FormatterConstructors["grid"] = NewGridFormatter
+}
+
+func (gf *GridFormatter) Finish() {
+}
+
+// FormatDiff formats the diff as a grid
+func (gf *GridFormatter) FormatDiff(diff FormattableDiff) (string, error) {
+	grid := diff.Grid()
+
+	if !gf.includeHeader || gf.index != 0 {
+		// Strip out the first line of the formatted output, which contains
+		// the headers. They've been left in up until this point in order to
+		// force the formatting of the columns to be wide enough.
+		firstNewLinePos := strings.Index(grid, "\n")
+		if firstNewLinePos >= 0 {
+			grid = grid[firstNewLinePos+1:]
+		}
+	}
+	gf.index++
+	if gf.index == headerInterval {
+		gf.index = 0
+	}
+
+	gf.increment()
+	return grid, nil
+}
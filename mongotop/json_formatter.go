@@ -0,0 +1,37 @@
+package mongotop
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JSONFormatter converts the diffs to JSON, one document per line. Times are
+// in milliseconds, with microsecond precision in the fields suffixed Micros,
+// and each document includes the length of its interval.
+type JSONFormatter struct {
+	*limitableFormatter
+}
+
+func NewJSONFormatter(o *Output) (DiffFormatter, error) {
+	return &JSONFormatter{
+		limitableFormatter: &limitableFormatter{maxRows: int64(o.RowCount)},
+	}, nil
+}
+
+func init() {
+	FormatterConstructors["json"] = NewJSONFormatter
+}
+
+func (jf *JSONFormatter) Finish() {
+}
+
+// FormatDiff formats the diff as JSON
+func (jf *JSONFormatter) FormatDiff(diff FormattableDiff) (string, error) {
+	bytes, err := json.Marshal(diff)
+	if err != nil {
+		return "", fmt.Errorf("error converting output to JSON: %v", err)
+	}
+
+	jf.increment()
+	return fmt.Sprintf("%s\n", bytes), nil
+}
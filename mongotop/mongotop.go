@@ -11,6 +11,10 @@ import (
 	"github.com/xkeyideal/mongo-tools/common/options"
 )
 
+// ChannelClosed and ChannelUnclosed are the values of StorageClosed.
+//
+// Deprecated: Storage is closed once its producer is done, so ranging over it
+// or the second result of Message tells when the output ended.
 const (
 	ChannelClosed   int32 = 1
 	ChannelUnclosed int32 = 0
@@ -25,29 +29,53 @@ type MongoTop struct {
 	// Mongotop-specific output options
 	OutputOptions *Output
 
-	// for connecting to the db
+	// for connecting to the db, nil in cluster mode
 	SessionProvider *db.SessionProvider
 
+	// the hosts polled in cluster mode, see NewMongoTopCluster
+	nodes []*topNode
+
 	// Length of time to sleep between each polling.
 	Sleeptime time.Duration
 
 	//持续时间
 	During int64
 
-	Storage       chan string
+	// Formatted output, closed once Run returns
+	Storage   chan string
+	closeOnce sync.Once
+
+	// StorageClosed is set to ChannelClosed, atomically, once Storage is
+	// closed.
+	//
+	// Deprecated: maintained for compatibility, see ChannelClosed.
 	StorageClosed int32
-	lock          sync.Mutex
 
-	numPrinted int32
-	startTime  int64
-	ctx        context.Context
-	cancel     context.CancelFunc
+	// Tracks Run, and the cluster polls left running after their deadline,
+	// so that Stop does not close the sessions under a poll. It holds Run
+	// from NewMongoTop on, and runOnce hands that hold to either Run or, if
+	// Stop comes first, to Stop.
+	running sync.WaitGroup
+	runOnce sync.Once
+
+	// Formats the diffs and counts the outputs, see NewDiffFormatter
+	formatter    DiffFormatter
+	formatterErr error
+
+	startTime int64
+	ctx       context.Context
+	cancel    context.CancelFunc
 
 	previousServerStatus *ServerStatus
 	previousTop          *Top
+
+	// compiled from the include and exclude patterns of OutputOptions
+	filter *NamespaceFilter
 }
 
-//mongotop  3.0.0+ not support --locks
+// NewMongoTop creates a MongoTop. With --locks, 3.0+ servers report the lock
+// acquisition rates per lock mode and the time spent waiting to acquire each
+// lock, rather than the time it was held.
 func NewMongoTop(ctx context.Context, opts *options.ToolOptions, oopts *Output, sp *db.SessionProvider,
 	st time.Duration, during int64) *MongoTop {
 
@@ -58,30 +86,32 @@ func NewMongoTop(ctx context.Context, opts *options.ToolOptions, oopts *Output,
 		Sleeptime:       st,
 		During:          during,
 		Storage:         make(chan string, 10),
-		StorageClosed:   0,
-		numPrinted:      0,
 		startTime:       time.Now().Unix(),
 	}
 
 	top.ctx, top.cancel = context.WithCancel(ctx)
+	top.running.Add(1)
+	// an unknown format is reported by Run
+	top.formatter, top.formatterErr = NewDiffFormatter(oopts)
 
 	return top
 }
 
+// onceDone closes Storage. Only Run sends on it, so it must be called by Run
+// on the way out, or once Run has returned. Output already queued stays
+// readable until it is drained.
 func (mt *MongoTop) onceDone() {
-	if atomic.LoadInt32(&mt.StorageClosed) == ChannelClosed {
-		return
-	}
-
-	mt.lock.Lock()
-	if mt.StorageClosed == ChannelUnclosed {
-		close(mt.Storage)
+	mt.closeOnce.Do(func() {
 		atomic.StoreInt32(&mt.StorageClosed, ChannelClosed)
-	}
-	mt.lock.Unlock()
+		close(mt.Storage)
+	})
 }
 
 func (mt *MongoTop) runDiff() (outDiff FormattableDiff, err error) {
+	if mt.nodes != nil {
+		return mt.runClusterDiff()
+	}
+
 	session, err := mt.SessionProvider.GetSession()
 	if err != nil {
 		return nil, err
@@ -105,24 +135,22 @@ func (mt *MongoTop) runDiff() (outDiff FormattableDiff, err error) {
 		mt.previousTop = nil
 		return nil, err
 	}
+	currentTop.sampleTime = time.Now()
 
 	if mt.OutputOptions.Locks {
 		if currentServerStatus.Locks == nil {
 			return nil, fmt.Errorf("server does not support reporting lock information")
 		}
-		for _, ns := range currentServerStatus.Locks {
-			if ns.AcquireCount != nil {
-				return nil, fmt.Errorf("server does not support reporting lock information")
-			}
-		}
 		if mt.previousServerStatus != nil {
 			serverStatusDiff := currentServerStatus.Diff(*mt.previousServerStatus)
+			serverStatusDiff.output = mt.OutputOptions
 			outDiff = serverStatusDiff
 		}
 		mt.previousServerStatus = &currentServerStatus
 	} else {
 		if mt.previousTop != nil {
-			topDiff := currentTop.Diff(*mt.previousTop)
+			topDiff := currentTop.Diff(*mt.previousTop, mt.filter)
+			topDiff.output = mt.OutputOptions
 			outDiff = topDiff
 		}
 		mt.previousTop = &currentTop
@@ -131,7 +159,7 @@ func (mt *MongoTop) runDiff() (outDiff FormattableDiff, err error) {
 }
 
 func (mt *MongoTop) IsFinished() bool {
-	if mt.OutputOptions.RowCount > 0 && atomic.LoadInt32(&mt.numPrinted) > mt.OutputOptions.RowCount {
+	if mt.formatter != nil && mt.formatter.IsFinished() {
 		return true
 	}
 
@@ -142,10 +170,34 @@ func (mt *MongoTop) IsFinished() bool {
 	return false
 }
 
-// Run executes the mongotop program.
+// Run executes the mongotop program. It is meant to be called once, and
+// returns at once if it was already called or Stop was.
 // https://docs.mongodb.com/v3.2/reference/program/mongotop/
 // https://docs.mongodb.com/v3.2/reference/command/top/
 func (mt *MongoTop) Run() error {
+	started := false
+	mt.runOnce.Do(func() { started = true })
+	if !started {
+		return nil
+	}
+	defer mt.running.Done()
+	defer mt.onceDone()
+
+	if mt.ctx.Err() != nil {
+		return nil
+	}
+	if err := mt.OutputOptions.Validate(); err != nil {
+		return err
+	}
+	if mt.formatterErr != nil {
+		return mt.formatterErr
+	}
+	defer mt.formatter.Finish()
+	filter, err := NewNamespaceFilter(mt.OutputOptions.Include, mt.OutputOptions.Exclude)
+	if err != nil {
+		return err
+	}
+	mt.filter = filter
 
 	hasData := false
 	ticker := time.NewTicker(mt.Sleeptime)
@@ -160,18 +212,14 @@ func (mt *MongoTop) Run() error {
 		select {
 		case <-ticker.C:
 			if mt.IsFinished() {
-				mt.onceDone()
 				return nil
 			}
 
-			atomic.AddInt32(&mt.numPrinted, 1)
-
 			diff, err := mt.runDiff()
 			if err != nil {
 				// If this is the first time trying to poll the server and it fails,
 				// just stop now instead of trying over and over.
 				if !hasData {
-					mt.onceDone()
 					return err
 				}
 			}
@@ -179,14 +227,18 @@ func (mt *MongoTop) Run() error {
 			hasData = true
 
 			if diff != nil {
-				if mt.OutputOptions.Json {
-					mt.Storage <- diff.JSON()
-				} else {
-					mt.Storage <- diff.Grid()
+				out, err := mt.formatter.FormatDiff(diff)
+				if err != nil {
+					return err
+				}
+				// output nobody reads any more is dropped on shutdown
+				select {
+				case mt.Storage <- out:
+				case <-mt.ctx.Done():
+					return nil
 				}
 			}
 		case <-mt.ctx.Done():
-			mt.onceDone()
 			//fmt.Println("mongotop ctx done")
 			return nil
 		}
@@ -194,14 +246,29 @@ func (mt *MongoTop) Run() error {
 }
 
 func (mt *MongoTop) Reset() {
-	atomic.StoreInt32(&mt.numPrinted, 0)
+	if mt.formatter != nil {
+		mt.formatter.ResetCount()
+	}
 	mt.startTime = time.Now().Unix()
 }
 
+// Wait blocks until Run, and any poll it left running, has returned, or
+// until Stop was called if Run never was. Output queued by then stays
+// readable on Storage until drained.
+func (mt *MongoTop) Wait() {
+	mt.running.Wait()
+}
+
+// Stop ends Run, waits for any poll in flight to finish and then releases
+// the connections. It also closes Storage if Run was never called.
 func (mt *MongoTop) Stop() {
-	if mt.cancel != nil {
-		mt.cancel()
-		mt.cancel = nil
+	mt.cancel()
+	// release the hold of a Run that never started, which then never will
+	mt.runOnce.Do(mt.running.Done)
+	mt.Wait()
+	mt.onceDone()
+	if mt.SessionProvider != nil {
+		mt.SessionProvider.Close()
 	}
-	mt.SessionProvider.Close()
+	mt.closeNodes()
 }
@@ -11,6 +11,43 @@ type Output struct {
 	Locks    bool
 	RowCount int32
 	Json     bool
+
+	// Format names the formatter in FormatterConstructors: grid, json, csv
+	// or template. Defaults to grid, or json if Json is set.
+	Format string
+
+	// Template is the text/template executed for each diff by the template format.
+	Template string
+
+	// NoHeaders leaves out the column names of the grid and csv formats.
+	NoHeaders bool
+
+	// Sort is the column the namespaces are ranked by in the grid, "total"
+	// by default. See Columns for the names.
+	Sort string
+
+	// Limit is the number of namespaces printed in the grid: 0 for the
+	// default of 10, or negative for all of them.
+	Limit int
+
+	// Columns is the subset of the columns to print in the grid, in order.
+	// For top these are "<op>" for the time, "<op>cnt" for the count and
+	// "<op>avg" for the average latency of each of total, read, write, query,
+	// getmore, insert, update, remove and cmd. With Locks they are total,
+	// read and write for the time spent in, or acquiring, the locks, and for
+	// 3.0+ servers also wait for the time all operations spent acquiring them
+	// as a percentage of the interval, which may exceed 100%, and acquire, waits and acquiring for the per second rates of
+	// acquisitions, acquisitions that waited and milliseconds spent waiting,
+	// each as "r|w|R|W" per lock mode.
+	Columns []string
+
+	// Latency adds the "<op>avg" columns to the default top columns.
+	Latency bool
+
+	// Include and Exclude select the namespaces reported by top, see
+	// NamespaceFilter for the patterns. They cannot be combined with Locks.
+	Include []string
+	Exclude []string
 }
 
 // Name returns a human-readable group name for output options.
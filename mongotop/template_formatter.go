@@ -0,0 +1,47 @@
+package mongotop
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// TemplateFormatter executes a text/template for each diff, with the diff,
+// e.g. a TopDiff, as its data.
+type TemplateFormatter struct {
+	*limitableFormatter
+
+	tmpl *template.Template
+}
+
+func NewTemplateFormatter(o *Output) (DiffFormatter, error) {
+	if o.Template == "" {
+		return nil, fmt.Errorf("the template format requires a template")
+	}
+	tmpl, err := template.New("mongotop").Parse(o.Template)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %v", err)
+	}
+	return &TemplateFormatter{
+		limitableFormatter: &limitableFormatter{maxRows: int64(o.RowCount)},
+		tmpl:               tmpl,
+	}, nil
+}
+
+func init() {
+	FormatterConstructors["template"] = NewTemplateFormatter
+}
+
+func (tf *TemplateFormatter) Finish() {
+}
+
+// FormatDiff executes the template with the diff
+func (tf *TemplateFormatter) FormatDiff(diff FormattableDiff) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := tf.tmpl.Execute(buf, diff); err != nil {
+		return "", fmt.Errorf("error executing template: %v", err)
+	}
+
+	tf.increment()
+	return buf.String(), nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/xkeyideal/mongo-tools/common/db"
+	"github.com/xkeyideal/mongo-tools/common/options"
+	"github.com/xkeyideal/mongo-tools/profiler"
+)
+
+func main() {
+	opts := options.New("mongoprofiler")
+	opts.Addrs = []string{"127.0.0.1:27017"}
+	opts.Source = "admin"
+	opts.Username = "root"
+	opts.Password = "123456789"
+	opts.Timeout = 2
+	opts.TCPKeepAliveSeconds = 2
+
+	sessionProvider, err := db.NewSessionProvider(opts)
+	if err != nil {
+		os.Exit(-1)
+	}
+	defer sessionProvider.Close()
+
+	p := profiler.NewProfiler(sessionProvider)
+
+	// profile every operation slower than 50ms for a minute, then restore
+	// the previous level
+	start := time.Now()
+	ps, err := p.ProfileFor(context.Background(), "MongoReplTest", profiler.LevelSlow, 50, time.Minute)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := ps.Wait(); err != nil {
+		fmt.Println(err)
+	}
+
+	entries, err := p.Read("MongoReplTest", start, 0)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	b, _ := json.Marshal(profiler.Aggregate(entries))
+	fmt.Println(string(b))
+}
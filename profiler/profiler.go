@@ -0,0 +1,203 @@
+package profiler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xkeyideal/mongo-tools/common/db"
+	"github.com/xkeyideal/mongo-tools/common/util"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Profiling levels
+const (
+	LevelOff  = 0
+	LevelSlow = 1
+	LevelAll  = 2
+)
+
+// ProfilingStatus is the profiling level of a database. Note that slowms is
+// shared by every database of the mongod.
+type ProfilingStatus struct {
+	Level      int     `bson:"was" json:"level"`
+	Slowms     int64   `bson:"slowms" json:"slowms"`
+	SampleRate float64 `bson:"sampleRate,omitempty" json:"sampleRate,omitempty"`
+}
+
+// ProfileEntry is a document of system.profile. Servers before 3.2 report
+// nscanned and nscannedObjects instead of keysExamined and docsExamined,
+// Read copies them into the newer fields.
+type ProfileEntry struct {
+	Op              string    `bson:"op" json:"op"`
+	Ns              string    `bson:"ns" json:"ns"`
+	Query           bson.D    `bson:"query,omitempty" json:"query,omitempty"`
+	Command         bson.D    `bson:"command,omitempty" json:"command,omitempty"`
+	UpdateObj       bson.D    `bson:"updateobj,omitempty" json:"updateobj,omitempty"`
+	KeysExamined    int64     `bson:"keysExamined" json:"keysExamined"`
+	DocsExamined    int64     `bson:"docsExamined" json:"docsExamined"`
+	NScanned        int64     `bson:"nscanned,omitempty" json:"-"`
+	NScannedObjects int64     `bson:"nscannedObjects,omitempty" json:"-"`
+	NReturned       int64     `bson:"nreturned" json:"nreturned"`
+	NModified       int64     `bson:"nModified,omitempty" json:"nModified,omitempty"`
+	ResponseLength  int64     `bson:"responseLength" json:"responseLength"`
+	Millis          int64     `bson:"millis" json:"millis"`
+	PlanSummary     string    `bson:"planSummary,omitempty" json:"planSummary,omitempty"`
+	Ts              time.Time `bson:"ts" json:"ts"`
+	Client          string    `bson:"client,omitempty" json:"client,omitempty"`
+	AppName         string    `bson:"appName,omitempty" json:"appName,omitempty"`
+	User            string    `bson:"user,omitempty" json:"user,omitempty"`
+}
+
+type Profiler struct {
+	// for connecting to the db
+	SessionProvider *db.SessionProvider
+}
+
+func NewProfiler(sp *db.SessionProvider) *Profiler {
+	return &Profiler{
+		SessionProvider: sp,
+	}
+}
+
+// https://docs.mongodb.com/v3.2/reference/command/profile/
+func (p *Profiler) runProfile(dbName string, cmd bson.D) (*ProfilingStatus, error) {
+	if err := util.ValidateDBName(dbName); err != nil {
+		return nil, err
+	}
+
+	session, err := p.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	dest := &ProfilingStatus{}
+	err = session.DB(dbName).Run(cmd, dest)
+	if err != nil {
+		return nil, fmt.Errorf("error running profile on %v: %v", dbName, err)
+	}
+	return dest, nil
+}
+
+// Status returns the profiling level and slowms of the database
+func (p *Profiler) Status(dbName string) (*ProfilingStatus, error) {
+	return p.runProfile(dbName, bson.D{{"profile", -1}})
+}
+
+// SetLevel sets the profiling level and slowms of the database, and returns
+// the previous settings. A negative slowms leaves it unchanged.
+func (p *Profiler) SetLevel(dbName string, level int, slowms int64) (*ProfilingStatus, error) {
+	if level < LevelOff || level > LevelAll {
+		return nil, fmt.Errorf("invalid profiling level %v, must be 0, 1 or 2", level)
+	}
+	cmd := bson.D{{"profile", level}}
+	if slowms >= 0 {
+		cmd = append(cmd, bson.DocElem{"slowms", slowms})
+	}
+	return p.runProfile(dbName, cmd)
+}
+
+// ProfilingSession restores the previous profiling settings of a database
+// once it ends.
+type ProfilingSession struct {
+	DB       string
+	Previous *ProfilingStatus
+
+	profiler *Profiler
+	once     sync.Once
+	done     chan struct{}
+	err      error
+}
+
+// ProfileFor sets the profiling level and slowms of the database, and
+// restores the previous settings after the duration, when the context is
+// cancelled or when Restore is called, whichever comes first.
+func (p *Profiler) ProfileFor(ctx context.Context, dbName string, level int, slowms int64, duration time.Duration) (*ProfilingSession, error) {
+	previous, err := p.SetLevel(dbName, level, slowms)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := &ProfilingSession{
+		DB:       dbName,
+		Previous: previous,
+		profiler: p,
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		timer := time.NewTimer(duration)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		case <-ps.done:
+			return
+		}
+		ps.Restore()
+	}()
+
+	return ps, nil
+}
+
+// Restore restores the previous profiling settings. It is safe to call more
+// than once, later calls return the error of the first.
+func (ps *ProfilingSession) Restore() error {
+	ps.once.Do(func() {
+		_, ps.err = ps.profiler.SetLevel(ps.DB, ps.Previous.Level, ps.Previous.Slowms)
+		close(ps.done)
+	})
+	<-ps.done
+	return ps.err
+}
+
+// Wait blocks until the previous settings are restored
+func (ps *ProfilingSession) Wait() error {
+	<-ps.done
+	return ps.err
+}
+
+// Read returns the entries of system.profile of the database since the given
+// time, oldest first. A zero since reads every entry, and a limit <= 0 reads
+// without a limit.
+func (p *Profiler) Read(dbName string, since time.Time, limit int) ([]ProfileEntry, error) {
+	if err := util.ValidateDBName(dbName); err != nil {
+		return nil, err
+	}
+
+	session, err := p.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	query := bson.M{}
+	if !since.IsZero() {
+		query["ts"] = bson.M{"$gte": since}
+	}
+
+	entries := []ProfileEntry{}
+	q := session.DB(dbName).C("system.profile").Find(query).Sort("ts")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	if err := q.All(&entries); err != nil {
+		return nil, fmt.Errorf("error reading %v.system.profile: %v", dbName, err)
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		if entry.KeysExamined == 0 {
+			entry.KeysExamined = entry.NScanned
+		}
+		if entry.DocsExamined == 0 {
+			entry.DocsExamined = entry.NScannedObjects
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,145 @@
+package profiler
+
+import (
+	"sort"
+
+	"github.com/xkeyideal/mongo-tools/common/util"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// shapeIgnoredFields are the command fields added by drivers and mongos,
+// which say nothing about the shape of the operation
+var shapeIgnoredFields = map[string]bool{
+	"$db":             true,
+	"lsid":            true,
+	"$clusterTime":    true,
+	"$readPreference": true,
+	"txnNumber":       true,
+	"maxTimeMS":       true,
+	"comment":         true,
+	"shardVersion":    true,
+}
+
+// EntryShape returns the shape of the query or command of a profile entry,
+// with its values replaced by their types.
+func EntryShape(entry *ProfileEntry) string {
+	doc := entry.Query
+	if len(doc) == 0 {
+		doc = entry.Command
+	}
+	// 3.0 nests the find filter under $query, e.g. with $orderby
+	if len(doc) > 0 && doc[0].Name == "$query" {
+		if inner, ok := doc[0].Value.(bson.D); ok {
+			doc = inner
+		}
+	}
+
+	trimmed := make(bson.D, 0, len(doc))
+	for _, elem := range doc {
+		if !shapeIgnoredFields[elem.Name] {
+			trimmed = append(trimmed, elem)
+		}
+	}
+	return util.ShapeString(util.Shape(trimmed))
+}
+
+// ShapeReport aggregates the profile entries of one query shape.
+type ShapeReport struct {
+	Op    string `json:"op"`
+	Ns    string `json:"ns"`
+	Shape string `json:"shape"`
+
+	Count       int64   `json:"count"`
+	TotalMillis int64   `json:"totalMillis"`
+	AvgMillis   float64 `json:"avgMillis"`
+	MaxMillis   int64   `json:"maxMillis"`
+
+	KeysExamined int64 `json:"keysExamined"`
+	DocsExamined int64 `json:"docsExamined"`
+	NReturned    int64 `json:"nreturned"`
+
+	// KeysExaminedPerReturned and DocsExaminedPerReturned are the examined
+	// keys and documents per returned document, high ratios suggest a
+	// missing or poor index. They are the examined counts when nothing was
+	// returned.
+	KeysExaminedPerReturned float64 `json:"keysExaminedPerReturned"`
+	DocsExaminedPerReturned float64 `json:"docsExaminedPerReturned"`
+
+	// PlanSummaries are the distinct plans used, most frequent first
+	PlanSummaries []string `json:"planSummaries,omitempty"`
+
+	planCounts map[string]int64
+}
+
+type shapeKey struct {
+	op, ns, shape string
+}
+
+// Aggregate groups the profile entries by operation, namespace and shape,
+// and returns a report per shape, slowest total first.
+func Aggregate(entries []ProfileEntry) []*ShapeReport {
+	byShape := map[shapeKey]*ShapeReport{}
+	reports := []*ShapeReport{}
+
+	for i := range entries {
+		entry := &entries[i]
+		key := shapeKey{entry.Op, entry.Ns, EntryShape(entry)}
+		report, ok := byShape[key]
+		if !ok {
+			report = &ShapeReport{
+				Op:         key.op,
+				Ns:         key.ns,
+				Shape:      key.shape,
+				planCounts: map[string]int64{},
+			}
+			byShape[key] = report
+			reports = append(reports, report)
+		}
+
+		report.Count++
+		report.TotalMillis += entry.Millis
+		if entry.Millis > report.MaxMillis {
+			report.MaxMillis = entry.Millis
+		}
+		report.KeysExamined += entry.KeysExamined
+		report.DocsExamined += entry.DocsExamined
+		report.NReturned += entry.NReturned
+		if entry.PlanSummary != "" {
+			report.planCounts[entry.PlanSummary]++
+		}
+	}
+
+	for _, report := range reports {
+		report.finish()
+	}
+
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].TotalMillis > reports[j].TotalMillis
+	})
+	return reports
+}
+
+// finish computes the averages, ratios and plan summaries
+func (report *ShapeReport) finish() {
+	report.AvgMillis = float64(report.TotalMillis) / float64(report.Count)
+
+	returned := float64(report.NReturned)
+	if returned == 0 {
+		returned = 1
+	}
+	report.KeysExaminedPerReturned = float64(report.KeysExamined) / returned
+	report.DocsExaminedPerReturned = float64(report.DocsExamined) / returned
+
+	report.PlanSummaries = make([]string, 0, len(report.planCounts))
+	for plan := range report.planCounts {
+		report.PlanSummaries = append(report.PlanSummaries, plan)
+	}
+	sort.Slice(report.PlanSummaries, func(i, j int) bool {
+		pi, pj := report.PlanSummaries[i], report.PlanSummaries[j]
+		if report.planCounts[pi] != report.planCounts[pj] {
+			return report.planCounts[pi] > report.planCounts[pj]
+		}
+		return pi < pj
+	})
+}
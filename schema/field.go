@@ -0,0 +1,222 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xkeyideal/mongo-tools/common/util"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// maxExamples is the number of distinct example values kept per field
+	maxExamples = 3
+
+	// maxExampleLength truncates long example values, in characters
+	maxExampleLength = 40
+)
+
+// Field is a field of the sampled documents. The elements of an array field
+// are described by its Items, whose path ends with "[]".
+type Field struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+
+	// Count is the number of values seen
+	Count int64 `json:"count"`
+
+	// Presence is the percentage of the parent objects with the field, it
+	// is not set for array items
+	Presence float64 `json:"presence"`
+
+	// Types counts the values by BSON type
+	Types map[string]int64 `json:"types"`
+
+	// Mixed is set when the field has more than one type, not counting null
+	Mixed bool `json:"mixed,omitempty"`
+
+	Examples []string `json:"examples,omitempty"`
+
+	ArrayLengths *ArrayLengths `json:"arrayLengths,omitempty"`
+
+	Fields []*Field `json:"fields,omitempty"`
+	Items  *Field   `json:"items,omitempty"`
+
+	// objects is the number of object values, i.e. the parents of Fields
+	objects  int64
+	children map[string]*Field
+	examples map[string]bool
+}
+
+// ArrayLengths are the lengths of the array values of a field.
+type ArrayLengths struct {
+	Min   int     `json:"min"`
+	Max   int     `json:"max"`
+	Avg   float64 `json:"avg"`
+	total int64
+	count int64
+}
+
+func newField(name, path string) *Field {
+	return &Field{
+		Name:     name,
+		Path:     path,
+		Types:    map[string]int64{},
+		children: map[string]*Field{},
+		examples: map[string]bool{},
+	}
+}
+
+func (f *Field) child(name string) *Field {
+	if child, ok := f.children[name]; ok {
+		return child
+	}
+	path := name
+	if f.Path != "" {
+		path = f.Path + "." + name
+	}
+	child := newField(name, path)
+	f.children[name] = child
+	f.Fields = append(f.Fields, child)
+	return child
+}
+
+// add records a value of the field
+func (f *Field) add(value interface{}) {
+	f.Count++
+	f.Types[util.BSONTypeName(value)]++
+
+	switch v := value.(type) {
+	case bson.D:
+		f.objects++
+		for _, elem := range v {
+			f.child(elem.Name).add(elem.Value)
+		}
+	case bson.M:
+		f.addMap(v)
+	case map[string]interface{}:
+		f.addMap(v)
+	case []interface{}:
+		if f.ArrayLengths == nil {
+			f.ArrayLengths = &ArrayLengths{Min: len(v), Max: len(v)}
+		}
+		lengths := f.ArrayLengths
+		if len(v) < lengths.Min {
+			lengths.Min = len(v)
+		}
+		if len(v) > lengths.Max {
+			lengths.Max = len(v)
+		}
+		lengths.total += int64(len(v))
+		lengths.count++
+
+		if f.Items == nil {
+			f.Items = newField("[]", f.Path+"[]")
+		}
+		for _, elem := range v {
+			f.Items.add(elem)
+		}
+	case nil:
+	default:
+		f.addExample(v)
+	}
+}
+
+func (f *Field) addMap(m map[string]interface{}) {
+	f.objects++
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f.child(key).add(m[key])
+	}
+}
+
+func (f *Field) addExample(value interface{}) {
+	if len(f.examples) >= maxExamples {
+		return
+	}
+	example := formatExample(value)
+	if !f.examples[example] {
+		f.examples[example] = true
+		f.Examples = append(f.Examples, example)
+	}
+}
+
+func formatExample(value interface{}) string {
+	var example string
+	switch v := value.(type) {
+	case string:
+		example = fmt.Sprintf("%q", v)
+	case time.Time:
+		example = v.Format(time.RFC3339)
+	case bson.ObjectId:
+		example = v.Hex()
+	case []byte:
+		example = fmt.Sprintf("<%v bytes>", len(v))
+	case bson.Binary:
+		example = fmt.Sprintf("<%v bytes>", len(v.Data))
+	default:
+		example = fmt.Sprint(v)
+	}
+	// truncate on a character boundary, so that multi-byte characters are
+	// not split into invalid UTF-8
+	if utf8.RuneCountInString(example) > maxExampleLength {
+		example = string([]rune(example)[:maxExampleLength]) + "..."
+	}
+	return example
+}
+
+// finish computes the presence, mixed types and array averages of the
+// field and its children
+func (f *Field) finish() {
+	types := len(f.Types)
+	if _, ok := f.Types["null"]; ok {
+		types--
+	}
+	f.Mixed = types > 1
+	if f.ArrayLengths != nil && f.ArrayLengths.count > 0 {
+		f.ArrayLengths.Avg = float64(f.ArrayLengths.total) / float64(f.ArrayLengths.count)
+	}
+	for _, child := range f.Fields {
+		if f.objects > 0 {
+			child.Presence = 100 * float64(child.Count) / float64(f.objects)
+		}
+		child.finish()
+	}
+	if f.Items != nil {
+		f.Items.finish()
+	}
+}
+
+// walk calls fn on the children and items of the field, depth first
+func (f *Field) walk(fn func(*Field)) {
+	for _, child := range f.Fields {
+		fn(child)
+		child.walk(fn)
+	}
+	if f.Items != nil {
+		fn(f.Items)
+		f.Items.walk(fn)
+	}
+}
+
+// sortedTypes returns the types of the field, most frequent first
+func (f *Field) sortedTypes() []string {
+	types := make([]string, 0, len(f.Types))
+	for t := range f.Types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if f.Types[types[i]] != f.Types[types[j]] {
+			return f.Types[types[i]] > f.Types[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	return types
+}
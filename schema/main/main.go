@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/xkeyideal/mongo-tools/common/db"
+	"github.com/xkeyideal/mongo-tools/common/options"
+	"github.com/xkeyideal/mongo-tools/schema"
+)
+
+func main() {
+	opts := options.New("mongoschema")
+	opts.Addrs = []string{"127.0.0.1:27017"}
+	opts.DB = "MongoReplTest"
+	opts.Collection = "users"
+	opts.Source = "admin"
+	opts.Username = "root"
+	opts.Password = "123456789"
+	opts.Timeout = 2
+	opts.TCPKeepAliveSeconds = 2
+
+	sessionProvider, err := db.NewSessionProvider(opts)
+	if err != nil {
+		os.Exit(-1)
+	}
+	defer sessionProvider.Close()
+
+	schemas, err := schema.NewSchema(opts, sessionProvider).Run(500)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, cs := range schemas {
+		fmt.Print(cs.Tree())
+		b, _ := json.MarshalIndent(cs.JSONSchema(), "", "  ")
+		fmt.Println(string(b))
+	}
+}
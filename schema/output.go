@@ -0,0 +1,104 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xkeyideal/mongo-tools/common/text"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Tree returns the fields, by path, as a table of their types, presence,
+// array lengths and examples, flagging mixed types.
+func (cs *CollectionSchema) Tree() string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%v: %v documents sampled by %v\n", cs.Namespace, cs.Sampled, cs.Method)
+
+	out := &text.GridWriter{ColumnPadding: 2}
+	out.WriteCells("field", "types", "presence", "notes", "examples")
+	out.EndRow()
+	cs.rootField().walk(func(f *Field) {
+		types := []string{}
+		for _, t := range f.sortedTypes() {
+			if len(f.Types) == 1 {
+				types = append(types, t)
+			} else {
+				types = append(types, fmt.Sprintf("%v(%v)", t, f.Types[t]))
+			}
+		}
+
+		presence := ""
+		if f.Name != "[]" {
+			presence = fmt.Sprintf("%.1f%%", f.Presence)
+		}
+
+		notes := []string{}
+		if f.Mixed {
+			notes = append(notes, "MIXED")
+		}
+		if f.ArrayLengths != nil {
+			notes = append(notes, fmt.Sprintf("len %v-%v avg %.1f",
+				f.ArrayLengths.Min, f.ArrayLengths.Max, f.ArrayLengths.Avg))
+		}
+
+		out.WriteCells(f.Path, strings.Join(types, " "), presence,
+			strings.Join(notes, " "), strings.Join(f.Examples, ", "))
+		out.EndRow()
+	})
+	out.Flush(buf)
+
+	if mixed := cs.MixedFields(); len(mixed) > 0 {
+		fmt.Fprintf(buf, "mixed types: %v\n", strings.Join(mixed, ", "))
+	}
+	return buf.String()
+}
+
+// JSON returns the schema as JSON
+func (cs *CollectionSchema) JSON() string {
+	bytes, err := json.Marshal(cs)
+	if err != nil {
+		return fmt.Sprintf(`{"json error": %q}`, err.Error())
+	}
+	return string(bytes)
+}
+
+// JSONSchema returns a draft $jsonSchema validator for the collection, e.g.
+// for collMod. Fields present in every sampled document are required. It
+// is a starting point to review, as a sample may miss rare fields and types.
+// https://docs.mongodb.com/v3.6/reference/operator/query/jsonSchema/
+func (cs *CollectionSchema) JSONSchema() bson.M {
+	return bson.M{"$jsonSchema": cs.rootField().jsonSchema()}
+}
+
+func (f *Field) jsonSchema() bson.M {
+	schema := bson.M{}
+
+	types := f.sortedTypes()
+	if len(types) == 1 {
+		schema["bsonType"] = types[0]
+	} else if len(types) > 1 {
+		schema["bsonType"] = types
+	}
+
+	if len(f.Fields) > 0 {
+		properties := bson.M{}
+		required := []string{}
+		for _, child := range f.Fields {
+			properties[child.Name] = child.jsonSchema()
+			if child.Presence == 100 {
+				required = append(required, child.Name)
+			}
+		}
+		schema["properties"] = properties
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	}
+	if f.Items != nil {
+		schema["items"] = f.Items.jsonSchema()
+	}
+	return schema
+}
@@ -0,0 +1,149 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xkeyideal/mongo-tools/common/db"
+	"github.com/xkeyideal/mongo-tools/common/options"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultSampleSize is the number of documents sampled per collection when
+// no size is given.
+const DefaultSampleSize = 1000
+
+// Sampling methods
+const (
+	MethodSample = "$sample"
+	MethodScan   = "scan"
+)
+
+// CollectionSchema is the schema inferred from a sample of a collection.
+type CollectionSchema struct {
+	Namespace string `json:"namespace"`
+	Method    string `json:"method"`
+	Sampled   int64  `json:"sampled"`
+
+	// Fields are the top level fields, in the order they were first seen
+	Fields []*Field `json:"fields"`
+
+	root *Field
+}
+
+type Schema struct {
+	Options *options.ToolOptions
+
+	// for connecting to the db
+	SessionProvider *db.SessionProvider
+}
+
+func NewSchema(opts *options.ToolOptions, sp *db.SessionProvider) *Schema {
+	return &Schema{
+		Options:         opts,
+		SessionProvider: sp,
+	}
+}
+
+// Run samples size documents, DefaultSampleSize if size <= 0, of the
+// collection of the options, or of every collection of the database when
+// no collection is given, and infers their schemas.
+func (s *Schema) Run(size int) ([]*CollectionSchema, error) {
+	if size <= 0 {
+		size = DefaultSampleSize
+	}
+
+	collections := []string{s.Options.Collection}
+	if s.Options.Collection == "" {
+		names, err := s.SessionProvider.CollectionNames(s.Options.DB)
+		if err != nil {
+			return nil, fmt.Errorf("error listing collections of %v: %v", s.Options.DB, err)
+		}
+		collections = collections[:0]
+		for _, name := range names {
+			if !strings.HasPrefix(name, "system.") {
+				collections = append(collections, name)
+			}
+		}
+	}
+
+	// $sample is only available on 3.2+
+	method := MethodScan
+	buildInfo, err := s.SessionProvider.BuildInfo()
+	if err == nil && buildInfo.VersionAtLeast(3, 2) {
+		method = MethodSample
+	}
+
+	schemas := []*CollectionSchema{}
+	for _, collection := range collections {
+		docs, err := s.sample(collection, method, size)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, Infer(s.Options.DB+"."+collection, method, docs))
+	}
+	return schemas, nil
+}
+
+// sample returns size random documents with $sample, or the first size
+// documents in natural order with a scan.
+// https://docs.mongodb.com/v3.2/reference/operator/aggregation/sample/
+func (s *Schema) sample(collection, method string, size int) ([]bson.D, error) {
+	session, err := s.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	docs := []bson.D{}
+	coll := session.DB(s.Options.DB).C(collection)
+	if method == MethodSample {
+		err = coll.Pipe([]bson.M{{"$sample": bson.M{"size": size}}}).AllowDiskUse().All(&docs)
+	} else {
+		err = coll.Find(nil).Limit(size).All(&docs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error sampling %v.%v: %v", s.Options.DB, collection, err)
+	}
+	return docs, nil
+}
+
+// Infer builds the field tree of the documents
+func Infer(namespace, method string, docs []bson.D) *CollectionSchema {
+	root := newField("", "")
+	for _, doc := range docs {
+		root.add(doc)
+	}
+	root.finish()
+
+	return &CollectionSchema{
+		Namespace: namespace,
+		Method:    method,
+		Sampled:   int64(len(docs)),
+		Fields:    root.Fields,
+		root:      root,
+	}
+}
+
+// rootField returns the root of the field tree, which is rebuilt from Fields
+// for a schema decoded from JSON.
+func (cs *CollectionSchema) rootField() *Field {
+	if cs.root != nil {
+		return cs.root
+	}
+	return &Field{Types: map[string]int64{"object": cs.Sampled}, Fields: cs.Fields}
+}
+
+// MixedFields returns the paths of the fields seen with more than one type,
+// not counting null.
+func (cs *CollectionSchema) MixedFields() []string {
+	mixed := []string{}
+	cs.rootField().walk(func(f *Field) {
+		if f.Mixed {
+			mixed = append(mixed, f.Path)
+		}
+	})
+	return mixed
+}
@@ -9,6 +9,9 @@ import (
 type ServerStatus struct {
 	// for connecting to the db
 	SessionProvider *db.SessionProvider
+
+	// Metrics requests the metrics section, which is large and left out by default.
+	Metrics bool
 }
 
 func NewServerStatus(sp *db.SessionProvider) *ServerStatus {
@@ -26,8 +29,13 @@ func (s *ServerStatus) Run() (*ServerStatusInfo, error) {
 	defer session.Close()
 	session.SetSocketTimeout(0)
 
+	cmd := bson.D{{"serverStatus", 1}}
+	if !s.Metrics {
+		cmd = append(cmd, bson.DocElem{"metrics", 0})
+	}
+
 	stat := &ServerStatusInfo{}
-	err = session.DB("admin").Run(bson.D{{"serverStatus", 1}, {"metrics", 0}}, stat)
+	err = session.DB("admin").Run(cmd, stat)
 
 	return stat, err
 }
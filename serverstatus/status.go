@@ -28,6 +28,7 @@ type ServerStatusInfo struct {
 	ShardCursorType    map[string]interface{} `bson:"shardCursorType" json:"shardCursorType"`
 	StorageEngine      *StorageEngine         `bson:"storageEngine" json:"storageEngine"`
 	WiredTiger         *WiredTiger            `bson:"wiredTiger" json:"wiredTiger"`
+	Metrics            *MetricsStats          `bson:"metrics,omitempty" json:"metrics,omitempty"`
 }
 
 type StorageEngine struct {
@@ -93,6 +94,62 @@ type ReplStatus struct {
 	Me         string   `bson:"me" json:"me"`
 }
 
+// MetricsStats stores the metrics section of serverStatus.
+type MetricsStats struct {
+	Document      DocumentStats      `bson:"document" json:"document"`
+	Operation     OperationStats     `bson:"operation" json:"operation"`
+	QueryExecutor QueryExecutorStats `bson:"queryExecutor" json:"queryExecutor"`
+	Cursor        CursorStats        `bson:"cursor" json:"cursor"`
+	Repl          ReplMetricsStats   `bson:"repl" json:"repl"`
+}
+
+// DocumentStats stores the number of documents touched by CRUD operations.
+type DocumentStats struct {
+	Deleted  int64 `bson:"deleted" json:"deleted"`
+	Inserted int64 `bson:"inserted" json:"inserted"`
+	Returned int64 `bson:"returned" json:"returned"`
+	Updated  int64 `bson:"updated" json:"updated"`
+}
+
+// OperationStats stores counts of special cased update and query operations.
+type OperationStats struct {
+	Fastmod        int64 `bson:"fastmod" json:"fastmod"`
+	Idhack         int64 `bson:"idhack" json:"idhack"`
+	ScanAndOrder   int64 `bson:"scanAndOrder" json:"scanAndOrder"`
+	WriteConflicts int64 `bson:"writeConflicts" json:"writeConflicts"`
+}
+
+// QueryExecutorStats stores the number of index keys and documents scanned.
+type QueryExecutorStats struct {
+	Scanned        int64 `bson:"scanned" json:"scanned"`
+	ScannedObjects int64 `bson:"scannedObjects" json:"scannedObjects"`
+}
+
+// CursorStats stores information related to cursor state.
+type CursorStats struct {
+	TimedOut int64           `bson:"timedOut" json:"timedOut"`
+	Open     OpenCursorStats `bson:"open" json:"open"`
+}
+
+// OpenCursorStats stores the number of cursors currently open.
+type OpenCursorStats struct {
+	NoTimeout int64 `bson:"noTimeout" json:"noTimeout"`
+	Pinned    int64 `bson:"pinned" json:"pinned"`
+	Total     int64 `bson:"total" json:"total"`
+}
+
+// ReplMetricsStats stores the replication metrics.
+type ReplMetricsStats struct {
+	Buffer ReplBufferStats `bson:"buffer" json:"buffer"`
+}
+
+// ReplBufferStats stores the state of the oplog buffer of a secondary.
+type ReplBufferStats struct {
+	Count        int64 `bson:"count" json:"count"`
+	MaxSizeBytes int64 `bson:"maxSizeBytes" json:"maxSizeBytes"`
+	SizeBytes    int64 `bson:"sizeBytes" json:"sizeBytes"`
+}
+
 // DBRecordStats stores data related to memory operations across databases.
 type DBRecordStats struct {
 	AccessesNotInMemory       int64                     `bson:"accessesNotInMemory" json:"accessesNotInMemory"`